@@ -0,0 +1,371 @@
+package capture
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/10gen/mongo-go-driver/bson"
+	"github.com/10gen/mongo-go-driver/mongo/private/msg"
+)
+
+// serve answers each request on the connection with a reply that echoes
+// the request id in its document. Like a server, it compresses the replies
+// to compressed requests with the compressor.
+func serve(t *testing.T, nc net.Conn, compressor msg.Compressor) {
+	codec := msg.NewWireProtocolCodec()
+	for {
+		req, err := readMessage(nc)
+		if err != nil {
+			return
+		}
+
+		id := readInt32(req, 4)
+		doc, err := bson.Marshal(bson.D{
+			{Name: "ok", Value: 1},
+			{Name: "request", Value: id},
+			{Name: "payload", Value: []byte("challenge")},
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var reply bytes.Buffer
+		err = codec.Encode(&reply, &msg.Reply{RespTo: id, NumberReturned: 1, DocumentsBytes: doc})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		b := reply.Bytes()
+		if readInt32(req, 12) == compressedOpCode {
+			if b, err = compress(b, compressor); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		if _, err = nc.Write(b); err != nil {
+			return
+		}
+	}
+}
+
+// compress wraps the message in an OP_COMPRESSED.
+func compress(m []byte, compressor msg.Compressor) ([]byte, error) {
+	data, err := compressor.Compress(m[headerLen:])
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, headerLen+9, headerLen+9+len(data))
+	copy(b, m[:headerLen])
+	setInt32(b, 12, compressedOpCode)
+	setInt32(b, 16, readInt32(m, 12))
+	setInt32(b, 20, int32(len(m)-headerLen))
+	b[24] = byte(compressor.ID())
+	b = append(b, data...)
+	setInt32(b, 0, int32(len(b)))
+	return b, nil
+}
+
+// requests creates the requests of a conversation, starting at the
+// request id. The SASL payloads hold a PLAIN password.
+func requests(id int32) []msg.Request {
+	return []msg.Request{
+		msg.NewCommand(id, "admin", true, bson.D{{Name: "ismaster", Value: 1}}),
+		msg.NewCommand(id+1, "$external", true, bson.D{
+			{Name: "saslStart", Value: 1},
+			{Name: "mechanism", Value: "PLAIN"},
+			{Name: "payload", Value: []byte("\x00user\x00secret password")},
+		}),
+		&msg.Msg{
+			ReqID: id + 2,
+			Sections: []msg.Section{&msg.SectionBody{Document: bson.D{
+				{Name: "saslContinue", Value: 1},
+				{Name: "conversationId", Value: 1},
+				{Name: "payload", Value: []byte("secret token")},
+				{Name: "$db", Value: "$external"},
+			}}},
+		},
+	}
+}
+
+// converse sends each request over the connection and returns the
+// documents of the replies.
+func converse(t *testing.T, codec msg.Codec, nc net.Conn, reqs []msg.Request) []bson.D {
+	var docs []bson.D
+	for _, req := range reqs {
+		if err := codec.Encode(nc, req); err != nil {
+			t.Fatalf("unable to send %T: %v", req, err)
+		}
+		m, err := codec.Decode(nc)
+		if err != nil {
+			t.Fatalf("unable to read the reply to %d: %v", req.RequestID(), err)
+		}
+		reply, ok := m.(*msg.Reply)
+		if !ok {
+			t.Fatalf("expected a reply, but got %T", m)
+		}
+		if reply.RespTo != req.RequestID() {
+			t.Errorf("expected a reply to %d, but got one to %d", req.RequestID(), reply.RespTo)
+		}
+		var doc bson.D
+		if err = bson.Unmarshal(reply.DocumentsBytes, &doc); err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// replay serves the events on a new listener and connects to it.
+func replay(t *testing.T, events []Event) (net.Listener, net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = NewReplayServer(events).Serve(l) }()
+
+	nc, err := net.DialTimeout("tcp", l.Addr().String(), time.Second)
+	if err != nil {
+		_ = l.Close()
+		t.Fatal(err)
+	}
+	_ = nc.SetDeadline(time.Now().Add(5 * time.Second))
+	return l, nc
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	client, server := net.Pipe()
+	go serve(t, server, nil)
+
+	var captured bytes.Buffer
+	codec := NewRecordingCodec(msg.NewWireProtocolCodec(), &captured)
+	recorded := converse(t, codec, client, requests(100))
+	_ = client.Close()
+	if err := codec.Err(); err != nil {
+		t.Fatalf("unable to record: %v", err)
+	}
+
+	if bytes.Contains(captured.Bytes(), []byte("secret")) {
+		t.Error("the capture holds the SASL credentials")
+	}
+
+	events, err := Read(&captured)
+	if err != nil {
+		t.Fatalf("unable to read the capture: %v", err)
+	}
+	expected := []struct {
+		dir      Direction
+		command  string
+		redacted bool
+	}{
+		{Sent, "ismaster", false},
+		{Received, "", false},
+		{Sent, "saslStart", true},
+		{Received, "", false},
+		{Sent, "saslContinue", true},
+		{Received, "", false},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, but got %d", len(expected), len(events))
+	}
+	for i, e := range expected {
+		if events[i].Direction != e.dir || events[i].Command != e.command || events[i].Redacted != e.redacted {
+			t.Errorf("event #%d: expected %s '%s' (redacted: %t), but got %s '%s' (redacted: %t)",
+				i+1, e.dir, e.command, e.redacted, events[i].Direction, events[i].Command, events[i].Redacted)
+		}
+	}
+
+	l, nc := replay(t, events)
+	defer l.Close()
+	defer nc.Close()
+
+	// the replies are the recorded ones, addressed to the new requests.
+	replayed := converse(t, msg.NewWireProtocolCodec(), nc, requests(500))
+	for i := range recorded {
+		if !docsEqual(recorded[i], replayed[i]) {
+			t.Errorf("reply #%d: expected %v, but got %v", i+1, recorded[i], replayed[i])
+		}
+	}
+}
+
+// compressedRequests creates the requests of a conversation that ends
+// with a command which, unlike the handshake and authentication, is
+// compressed once a compressor is negotiated.
+func compressedRequests(id int32) []msg.Request {
+	return append(requests(id), &msg.Msg{
+		ReqID: id + 3,
+		Sections: []msg.Section{&msg.SectionBody{Document: bson.D{
+			{Name: "ping", Value: 1},
+			{Name: "$db", Value: "admin"},
+		}}},
+	})
+}
+
+func TestRecordAndReplay_compressed(t *testing.T) {
+	zlib, err := msg.NewZlibCompressor(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, server := net.Pipe()
+	go serve(t, server, zlib)
+
+	// like the driver, compress what the recording codec writes.
+	var captured bytes.Buffer
+	codec := NewRecordingCodec(msg.NewWireProtocolCodec(), &captured)
+	recorded := converse(t, codec, msg.NewCompressingConn(client, zlib), compressedRequests(100))
+	_ = client.Close()
+	if err = codec.Err(); err != nil {
+		t.Fatalf("unable to record: %v", err)
+	}
+
+	events, err := Read(&captured)
+	if err != nil {
+		t.Fatalf("unable to read the capture: %v", err)
+	}
+	if len(events) != 8 {
+		t.Fatalf("expected 8 events, but got %d", len(events))
+	}
+	if events[6].Command != "ping" {
+		t.Errorf("expected ping, but got '%s'", events[6].Command)
+	}
+	for i, e := range events {
+		if e.OpCode == compressedOpCode {
+			t.Errorf("event #%d was recorded compressed", i+1)
+		}
+	}
+
+	l, nc := replay(t, events)
+	defer l.Close()
+	defer nc.Close()
+
+	// the client compresses the ping, like a driver that negotiated zlib.
+	replayed := converse(t, msg.NewWireProtocolCodec(), msg.NewCompressingConn(nc, zlib), compressedRequests(500))
+	for i := range recorded {
+		if !docsEqual(recorded[i], replayed[i]) {
+			t.Errorf("reply #%d: expected %v, but got %v", i+1, recorded[i], replayed[i])
+		}
+	}
+}
+
+func TestReplay_compressed_capture(t *testing.T) {
+	zlib, err := msg.NewZlibCompressor(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a capture of the messages as they were on the wire, where the
+	// ping and its reply were compressed.
+	var events []Event
+	for _, req := range compressedRequests(100) {
+		var b bytes.Buffer
+		if err = msg.NewWireProtocolCodec().Encode(&b, req); err != nil {
+			t.Fatal(err)
+		}
+		doc, err := bson.Marshal(bson.D{{Name: "ok", Value: 1}, {Name: "request", Value: req.RequestID()}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reply := &msg.Reply{ReqID: req.RequestID() + 1000, RespTo: req.RequestID(), NumberReturned: 1, DocumentsBytes: doc}
+		if err = msg.NewWireProtocolCodec().Encode(&b, reply); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, data := range splitMessages(b.Bytes()) {
+			if req.RequestID() == 103 {
+				if data, err = compress(data, zlib); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dir := Sent
+			if i == 1 {
+				dir = Received
+			}
+			events = append(events, newEvent("wire", dir, data))
+		}
+	}
+	if events[6].OpCode != compressedOpCode || events[7].OpCode != compressedOpCode {
+		t.Fatal("expected the ping and its reply to be compressed")
+	}
+
+	l, nc := replay(t, events)
+	defer l.Close()
+	defer nc.Close()
+
+	replayed := converse(t, msg.NewWireProtocolCodec(), msg.NewCompressingConn(nc, zlib), compressedRequests(500))
+	if len(replayed) != 4 {
+		t.Fatalf("expected 4 replies, but got %d", len(replayed))
+	}
+	// the recorded reply to the ping is sent, though it was compressed.
+	expected := bson.D{{Name: "ok", Value: 1}, {Name: "request", Value: int32(103)}}
+	if !docsEqual(expected, replayed[3]) {
+		t.Errorf("expected %v, but got %v", expected, replayed[3])
+	}
+}
+
+func TestRecordAndReplay_diverged(t *testing.T) {
+	client, server := net.Pipe()
+	go serve(t, server, nil)
+
+	var captured bytes.Buffer
+	converse(t, NewRecordingCodec(msg.NewWireProtocolCodec(), &captured), client, requests(1)[:1])
+	_ = client.Close()
+	events, err := Read(&captured)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, nc := replay(t, events)
+	defer l.Close()
+	defer nc.Close()
+
+	// a connection that starts with a command nobody recorded is refused.
+	codec := msg.NewWireProtocolCodec()
+	if err = codec.Encode(nc, requests(1)[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = codec.Decode(nc); err == nil {
+		t.Error("expected the connection to be closed")
+	}
+}
+
+func docsEqual(a, b bson.D) bool {
+	ab, err := bson.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bb, err := bson.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ab, bb)
+}
+
+func TestRedactSasl_wrapped(t *testing.T) {
+	m := msg.NewCommand(1, "$external", false, bson.D{
+		{Name: "saslStart", Value: 1},
+		{Name: "payload", Value: []byte("secret")},
+	})
+	// a read preference wraps the command in $query.
+	m.(*msg.Query).Query = bson.D{
+		{Name: "$query", Value: m.(*msg.Query).Query},
+		{Name: "$readPreference", Value: bson.D{{Name: "mode", Value: "secondaryPreferred"}}},
+	}
+
+	var b bytes.Buffer
+	if err := msg.NewWireProtocolCodec().Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	e := newEvent("", Sent, b.Bytes())
+	if e.Command != "saslStart" {
+		t.Fatalf("expected saslStart, but got '%s'", e.Command)
+	}
+	if !redactSasl(&e) || bytes.Contains(e.Data, []byte("secret")) {
+		t.Error("expected the payload to be redacted")
+	}
+	if int(readInt32(e.Data, 0)) != len(e.Data) {
+		t.Error("redaction changed the length of the message")
+	}
+}
@@ -0,0 +1,119 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/10gen/mongo-go-driver/mongo/private/msg"
+)
+
+// NewRecordingCodec creates a codec that uses codec to encode and decode
+// messages and writes every message to w. Compressed messages are written
+// as they were before compression, so that the capture can be replayed
+// whichever compressor a client negotiates. The payloads of SASL requests are blanked out, as they hold the
+// client's credentials. The codec may be shared by any number of
+// connections.
+func NewRecordingCodec(codec msg.Codec, w io.Writer) *RecordingCodec {
+	return &RecordingCodec{
+		codec: codec,
+		enc:   json.NewEncoder(w),
+	}
+}
+
+// RecordingCodec is a msg.Codec that records the traffic passing through it.
+type RecordingCodec struct {
+	codec msg.Codec
+
+	lock sync.Mutex
+	enc  *json.Encoder
+	err  error
+}
+
+// Encode encodes a number of messages to the writer.
+func (c *RecordingCodec) Encode(writer io.Writer, msgs ...msg.Message) error {
+	var buf bytes.Buffer
+	err := c.codec.Encode(&buf, msgs...)
+	if err != nil {
+		return err
+	}
+
+	c.record(connID(writer), Sent, buf.Bytes())
+
+	_, err = writer.Write(buf.Bytes())
+	if err != nil {
+		return &writeError{err}
+	}
+	return nil
+}
+
+// writeError is the error of writing messages to a connection. It keeps
+// the connection's error, so the driver can tell a timeout apart from a
+// broken connection.
+type writeError struct {
+	inner error
+}
+
+func (e *writeError) Error() string {
+	return fmt.Sprintf("unable to encode messages: %v", e.inner)
+}
+
+// Message gets the basic error message.
+func (e *writeError) Message() string {
+	return "unable to encode messages"
+}
+
+// Inner gets the connection's error.
+func (e *writeError) Inner() error {
+	return e.inner
+}
+
+// Decode decodes one message from the reader.
+func (c *RecordingCodec) Decode(reader io.Reader) (msg.Message, error) {
+	var buf bytes.Buffer
+	m, err := c.codec.Decode(io.TeeReader(reader, &buf))
+	if buf.Len() > 0 {
+		c.record(connID(reader), Received, buf.Bytes())
+	}
+	return m, err
+}
+
+// Err returns the first error encountered while writing the capture.
+func (c *RecordingCodec) Err() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.err
+}
+
+func (c *RecordingCodec) record(conn string, dir Direction, b []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	for _, data := range splitMessages(b) {
+		// the buffer is reused by the caller, so the event needs its own copy.
+		e := newEvent(conn, dir, append([]byte(nil), decompress(data)...))
+		e.Redacted = redactSasl(&e)
+		if err := c.enc.Encode(&e); err != nil {
+			c.err = err
+			return
+		}
+	}
+}
+
+// connID identifies the connection a codec is reading from or writing to.
+// The driver hands its net.Conn directly to the codec, so the local and
+// remote addresses uniquely identify it.
+func connID(rw interface{}) string {
+	if nc, ok := rw.(net.Conn); ok {
+		return fmt.Sprintf("%s->%s", nc.LocalAddr(), nc.RemoteAddr())
+	}
+
+	return fmt.Sprintf("%p", rw)
+}
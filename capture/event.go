@@ -0,0 +1,212 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/10gen/mongo-go-driver/bson"
+	"github.com/10gen/mongo-go-driver/mongo/private/msg"
+)
+
+// Direction indicates whether a message was sent or received by the client.
+type Direction string
+
+// Direction constants.
+const (
+	Sent     Direction = "sent"
+	Received Direction = "received"
+)
+
+// Event is a single wire-protocol message observed on a connection.
+type Event struct {
+	Time       time.Time `json:"time"`
+	Conn       string    `json:"conn"`
+	Direction  Direction `json:"dir"`
+	OpCode     int32     `json:"opCode"`
+	RequestID  int32     `json:"requestId"`
+	ResponseTo int32     `json:"responseTo"`
+	Command    string    `json:"command,omitempty"`
+	// Redacted tells whether credentials were blanked out of Data.
+	Redacted bool   `json:"redacted,omitempty"`
+	Data     []byte `json:"data"`
+}
+
+// ReadFile reads all the events from a capture file.
+func ReadFile(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Read(f)
+}
+
+// Read reads all the events from a capture.
+func Read(r io.Reader) ([]Event, error) {
+	var events []Event
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var e Event
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid capture event #%d: %v", len(events)+1, err)
+		}
+		events = append(events, e)
+	}
+}
+
+const (
+	headerLen        = 16
+	queryOpCode      = 2004
+	compressedOpCode = 2012
+	msgOpCode        = 2013
+)
+
+func newEvent(conn string, dir Direction, data []byte) Event {
+	e := Event{
+		Time:      time.Now().UTC(),
+		Conn:      conn,
+		Direction: dir,
+		Data:      data,
+	}
+
+	if len(data) >= headerLen {
+		e.RequestID = readInt32(data, 4)
+		e.ResponseTo = readInt32(data, 8)
+		e.OpCode = readInt32(data, 12)
+	}
+
+	switch e.OpCode {
+	case queryOpCode:
+		e.Command = queryCommandName(data)
+	case msgOpCode:
+		e.Command = msgCommandName(data)
+	}
+
+	return e
+}
+
+// queryCommandName returns the name of the command in an OP_QUERY
+// message, or an empty string if it cannot be determined.
+func queryCommandName(data []byte) string {
+	return commandName(queryCommandDoc(data))
+}
+
+// queryCommandDoc returns the query document of an OP_QUERY message, or
+// nil if it cannot be found.
+func queryCommandDoc(data []byte) []byte {
+	// skip the header and the flags
+	pos := headerLen + 4
+	for pos < len(data) && data[pos] != 0 {
+		pos++
+	}
+	// skip the terminating null, numberToSkip and numberToReturn
+	pos += 1 + 8
+	if pos+4 > len(data) {
+		return nil
+	}
+
+	n := int(readInt32(data, pos))
+	if n < 5 || pos+n > len(data) {
+		return nil
+	}
+
+	return data[pos : pos+n]
+}
+
+// msgCommandName returns the name of the command in the body section
+// of an OP_MSG message, or an empty string if it cannot be determined.
+func msgCommandName(data []byte) string {
+	return commandName(msgCommandDoc(data))
+}
+
+// msgCommandDoc returns the document of the body section of an OP_MSG
+// message, or nil if it cannot be found.
+func msgCommandDoc(data []byte) []byte {
+	// skip the header and the flag bits
+	pos := headerLen + 4
+	for pos+5 <= len(data) {
+		kind := data[pos]
+		n := int(readInt32(data, pos+1))
+		if n < 5 || pos+1+n > len(data) {
+			return nil
+		}
+		if kind == 0 {
+			return data[pos+1 : pos+1+n]
+		}
+		pos += 1 + n
+	}
+
+	return nil
+}
+
+func commandName(b []byte) string {
+	if b == nil {
+		return ""
+	}
+
+	var doc bson.RawD
+	if err := bson.Unmarshal(b, &doc); err != nil || len(doc) == 0 {
+		return ""
+	}
+
+	if doc[0].Name == "$query" {
+		var query bson.RawD
+		if err := doc[0].Value.Unmarshal(&query); err != nil || len(query) == 0 {
+			return ""
+		}
+		return query[0].Name
+	}
+
+	return doc[0].Name
+}
+
+// decompress returns the original message of an OP_COMPRESSED message.
+// Any other message, or one that cannot be decompressed, is returned as is.
+func decompress(data []byte) []byte {
+	original, err := msg.Decompress(data)
+	if err != nil {
+		return data
+	}
+	return original
+}
+
+// splitMessages splits a buffer containing any number of
+// complete messages into the individual messages.
+func splitMessages(b []byte) [][]byte {
+	var msgs [][]byte
+	for len(b) >= 4 {
+		n := int(readInt32(b, 0))
+		if n < 4 || n > len(b) {
+			break
+		}
+		msgs = append(msgs, b[:n])
+		b = b[n:]
+	}
+	if len(b) > 0 {
+		msgs = append(msgs, b)
+	}
+	return msgs
+}
+
+func readInt32(b []byte, pos int) int32 {
+	return (int32(b[pos+0])) |
+		(int32(b[pos+1]) << 8) |
+		(int32(b[pos+2]) << 16) |
+		(int32(b[pos+3]) << 24)
+}
+
+func setInt32(b []byte, pos int, i int32) {
+	b[pos] = byte(i)
+	b[pos+1] = byte(i >> 8)
+	b[pos+2] = byte(i >> 16)
+	b[pos+3] = byte(i >> 24)
+}
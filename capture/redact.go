@@ -0,0 +1,70 @@
+package capture
+
+import (
+	"strings"
+
+	"github.com/10gen/mongo-go-driver/bson"
+)
+
+const binaryKind = 0x05
+
+// redactSasl blanks out the payload of a saslStart or saslContinue
+// request, which holds the client's credentials: the password itself for
+// PLAIN, or a replayable kerberos ticket for GSSAPI. The payload is
+// overwritten in place, so the message keeps its length and can still be
+// replayed. It reports whether the message was redacted.
+func redactSasl(e *Event) bool {
+	if e.Direction != Sent {
+		return false
+	}
+	switch strings.ToLower(e.Command) {
+	case "saslstart", "saslcontinue":
+	default:
+		return false
+	}
+
+	var doc []byte
+	switch e.OpCode {
+	case queryOpCode:
+		doc = queryCommandDoc(e.Data)
+	case msgOpCode:
+		doc = msgCommandDoc(e.Data)
+	}
+
+	return redactBinary(doc, "payload")
+}
+
+// redactBinary zeroes the data of the binary element with the name in the
+// document, looking into the $query document of a wrapped command.
+func redactBinary(doc []byte, name string) bool {
+	var elems bson.RawD
+	if err := bson.Unmarshal(doc, &elems); err != nil {
+		return false
+	}
+
+	// the elements follow the document's length; each is its kind, its
+	// null-terminated name and its value.
+	pos := 4
+	for i, elem := range elems {
+		value := pos + 1 + len(elem.Name) + 1
+		end := value + len(elem.Value.Data)
+		if end > len(doc) {
+			return false
+		}
+
+		switch {
+		case i == 0 && elem.Name == "$query":
+			return redactBinary(doc[value:end], name)
+		case elem.Name == name && elem.Value.Kind == binaryKind && end-value >= 5:
+			// the length and the subtype are kept.
+			data := doc[value+5 : end]
+			for j := range data {
+				data[j] = 0
+			}
+			return true
+		}
+		pos = end
+	}
+
+	return false
+}
@@ -0,0 +1,226 @@
+package capture
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// NewReplayServer creates a server that answers clients with the
+// replies recorded in events.
+//
+// Each client connection is bound to the first unused recorded connection
+// whose first request is the same command. Requests are then matched in
+// order against the recorded ones, and the recorded replies are sent back
+// with their responseTo rewritten to the client's request ids. Once a
+// recorded connection is exhausted, commands it has already seen (such
+// as heartbeats) keep getting the last reply recorded for them. Compressed
+// requests are matched by their original message, and every reply is
+// sent uncompressed, which clients accept whatever they negotiated.
+// Recorded messages that are compressed, as in captures of the messages as
+// they were on the wire, are replayed as their original messages.
+func NewReplayServer(events []Event) *ReplayServer {
+	s := &ReplayServer{}
+
+	byConn := make(map[string]*stream)
+	for _, e := range events {
+		if e.OpCode == compressedOpCode {
+			original := newEvent(e.Conn, e.Direction, decompress(e.Data))
+			original.Time = e.Time
+			original.Redacted = e.Redacted
+			e = original
+		}
+
+		st, ok := byConn[e.Conn]
+		if !ok {
+			st = &stream{id: e.Conn}
+			byConn[e.Conn] = st
+			s.streams = append(s.streams, st)
+		}
+		st.events = append(st.events, e)
+	}
+
+	return s
+}
+
+// ReplayServer serves a capture back to clients.
+type ReplayServer struct {
+	// Logf, if set, receives a line for each client connection
+	// that is bound, diverges from the capture, or is closed.
+	Logf func(format string, args ...interface{})
+
+	lock    sync.Mutex
+	streams []*stream
+}
+
+// Serve accepts connections on the listener and replays the capture
+// to each of them. It returns when the listener fails.
+func (s *ReplayServer) Serve(l net.Listener) error {
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			err := s.serveConn(nc)
+			if err != nil && err != io.EOF {
+				s.logf("%s: %v", nc.RemoteAddr(), err)
+			}
+			_ = nc.Close()
+		}()
+	}
+}
+
+func (s *ReplayServer) serveConn(nc net.Conn) error {
+	var st *stream
+	for {
+		req, err := readMessage(nc)
+		if err != nil {
+			return err
+		}
+		e := newEvent("", Sent, decompress(req))
+
+		if st == nil {
+			st = s.bind(e.Command)
+			if st == nil {
+				return fmt.Errorf("no recorded connection starts with '%s'", e.Command)
+			}
+			s.logf("%s: replaying %s", nc.RemoteAddr(), st.id)
+		}
+
+		replies, err := st.next(e)
+		if err != nil {
+			return fmt.Errorf("replay of %s diverged: %v", st.id, err)
+		}
+
+		for _, reply := range replies {
+			if _, err = nc.Write(reply); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *ReplayServer) bind(command string) *stream {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, st := range s.streams {
+		if st.bound {
+			continue
+		}
+		for _, e := range st.events {
+			if e.Direction == Sent {
+				if e.Command == command {
+					st.bound = true
+					return st
+				}
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *ReplayServer) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+type stream struct {
+	id     string
+	events []Event
+	bound  bool
+
+	pos       int
+	requests  map[int32]int32
+	lastReply map[string][][]byte
+}
+
+// next consumes the recorded request matching req and returns the replies
+// that are now due, already rewritten for the client.
+func (st *stream) next(req Event) ([][]byte, error) {
+	if st.requests == nil {
+		st.requests = make(map[int32]int32)
+		st.lastReply = make(map[string][][]byte)
+	}
+
+	for st.pos < len(st.events) && st.events[st.pos].Direction != Sent {
+		st.pos++
+	}
+
+	if st.pos == len(st.events) {
+		replies, ok := st.lastReply[req.Command]
+		if !ok {
+			return nil, fmt.Errorf("capture exhausted, got unexpected '%s'", req.Command)
+		}
+		return rewriteReplies(replies, req.RequestID), nil
+	}
+
+	recorded := st.events[st.pos]
+	if recorded.OpCode != req.OpCode || recorded.Command != req.Command {
+		return nil, fmt.Errorf("expected '%s' (opcode %d), but got '%s' (opcode %d)",
+			recorded.Command, recorded.OpCode, req.Command, req.OpCode)
+	}
+	st.requests[recorded.RequestID] = req.RequestID
+	st.pos++
+
+	var replies [][]byte
+	for st.pos < len(st.events) && st.events[st.pos].Direction == Received {
+		e := st.events[st.pos]
+		reply := append([]byte(nil), e.Data...)
+		if id, ok := st.requests[e.ResponseTo]; ok && len(reply) >= headerLen {
+			setInt32(reply, 8, id)
+		}
+		replies = append(replies, reply)
+		st.lastReply[st.commandFor(e.ResponseTo)] = [][]byte{e.Data}
+		st.pos++
+	}
+
+	return replies, nil
+}
+
+func (st *stream) commandFor(requestID int32) string {
+	for _, e := range st.events {
+		if e.Direction == Sent && e.RequestID == requestID {
+			return e.Command
+		}
+	}
+	return ""
+}
+
+func rewriteReplies(replies [][]byte, responseTo int32) [][]byte {
+	var rewritten [][]byte
+	for _, r := range replies {
+		reply := append([]byte(nil), r...)
+		if len(reply) >= headerLen {
+			setInt32(reply, 8, responseTo)
+		}
+		rewritten = append(rewritten, reply)
+	}
+	return rewritten
+}
+
+func readMessage(r io.Reader) ([]byte, error) {
+	lengthBytes := make([]byte, 4)
+	if _, err := io.ReadFull(r, lengthBytes); err != nil {
+		return nil, err
+	}
+
+	length := readInt32(lengthBytes, 0)
+	if length < headerLen {
+		return nil, fmt.Errorf("invalid message length %d", length)
+	}
+
+	b := make([]byte, length)
+	copy(b, lengthBytes)
+	if _, err := io.ReadFull(r, b[4:]); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
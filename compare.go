@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/10gen/mongo-go-driver/bson"
+	"github.com/10gen/mongo-go-driver/mongo/private/auth"
+	"github.com/10gen/mongo-go-driver/mongo/private/conn"
+	"github.com/10gen/mongo-go-driver/mongo/private/msg"
+)
+
+// testMechanisms gets the mechanisms the test command authenticates with.
+func testMechanisms(mechanism string) ([]string, error) {
+	switch strings.ToUpper(mechanism) {
+	case auth.GSSAPI:
+		return []string{auth.GSSAPI}, nil
+	case auth.PLAIN:
+		return []string{auth.PLAIN}, nil
+	case "BOTH":
+		return []string{auth.GSSAPI, auth.PLAIN}, nil
+	}
+	return nil, fmt.Errorf("invalid mechanism %q, expected %s, %s or both", mechanism, auth.GSSAPI, auth.PLAIN)
+}
+
+// authResult is the outcome of authenticating with one mechanism.
+type authResult struct {
+	mechanism string
+	duration  time.Duration
+	users     []string
+	roles     []string
+	err       error
+}
+
+type connectionStatus struct {
+	AuthInfo struct {
+		AuthenticatedUsers []struct {
+			User string `bson:"user"`
+			DB   string `bson:"db"`
+		} `bson:"authenticatedUsers"`
+		AuthenticatedUserRoles []struct {
+			Role string `bson:"role"`
+			DB   string `bson:"db"`
+		} `bson:"authenticatedUserRoles"`
+	} `bson:"authInfo"`
+}
+
+func (s *connectionStatus) users() []string {
+	var users []string
+	for _, u := range s.AuthInfo.AuthenticatedUsers {
+		users = append(users, u.User+"@"+u.DB)
+	}
+	return users
+}
+
+func (s *connectionStatus) roles() []string {
+	var roles []string
+	for _, r := range s.AuthInfo.AuthenticatedUserRoles {
+		roles = append(roles, r.Role+"@"+r.DB)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// getConnectionStatus asks the server which users the connection is
+// authenticated as and which roles they have. For an LDAP user the roles
+// are the ones the server mapped its LDAP groups to.
+func getConnectionStatus(ctx context.Context, c conn.Connection) (*connectionStatus, error) {
+	request := msg.NewCommand(
+		msg.NextRequestID(),
+		"admin",
+		true,
+		bson.D{{Name: "connectionStatus", Value: 1}},
+	)
+
+	var status connectionStatus
+	if err := conn.ExecuteCommand(ctx, c, request, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// printComparison prints the results of the mechanisms side by side.
+func printComparison(username string, results []*authResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	row := func(name string, value func(r *authResult) string) {
+		fmt.Fprint(w, name)
+		for _, r := range results {
+			fmt.Fprintf(w, "\t%s", value(r))
+		}
+		fmt.Fprintln(w)
+	}
+
+	row(username, func(r *authResult) string { return r.mechanism })
+	row("result", func(r *authResult) string {
+		if r.err != nil {
+			return "failed"
+		}
+		return "succeeded"
+	})
+	row("auth time", func(r *authResult) string { return r.duration.Round(time.Millisecond).String() })
+	row("users", func(r *authResult) string { return listOrNone(r.users) })
+	row("roles", func(r *authResult) string { return listOrNone(r.roles) })
+	_ = w.Flush()
+
+	for _, r := range results {
+		if r.err != nil {
+			fmt.Printf("%s error: %v\n", r.mechanism, r.err)
+		}
+	}
+
+	first := results[0]
+	for _, r := range results[1:] {
+		if first.err != nil || r.err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(first.roles, r.roles) {
+			fmt.Printf("warning: %s and %s map %s to different roles\n", first.mechanism, r.mechanism, username)
+		}
+	}
+}
+
+func listOrNone(list []string) string {
+	if len(list) == 0 {
+		return "none"
+	}
+	return strings.Join(list, ", ")
+}
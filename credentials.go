@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/10gen/mongo-go-driver/mongo/private/auth"
+)
+
+const passwordSources = "prompt, env:NAME, file:PATH or cmd:COMMAND [ARGS...]"
+
+// passwordProvider creates the credential provider described by source,
+// which is one of passwordSources.
+func passwordProvider(source string) (auth.CredentialProvider, error) {
+	kind, value := source, ""
+	if i := strings.Index(source, ":"); i >= 0 {
+		kind, value = source[:i], source[i+1:]
+	}
+
+	switch kind {
+	case "prompt":
+		return auth.PromptProvider("password: "), nil
+	case "env":
+		if value != "" {
+			return auth.EnvProvider(value), nil
+		}
+	case "file":
+		if value != "" {
+			return auth.FileProvider(value), nil
+		}
+	case "cmd":
+		if fields := strings.Fields(value); len(fields) > 0 {
+			return auth.CommandProvider(fields[0], fields[1:]...), nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid password source %q, expected %s", source, passwordSources)
+}
+
+// mechanismProperties creates the GSSAPI mechanism properties for the
+// keytab, credential cache and authorization identity flags.
+func mechanismProperties(keytab, ccache, authzid string) map[string]string {
+	props := make(map[string]string)
+	if keytab != "" {
+		props["KEYTAB"] = keytab
+	}
+	if ccache != "" {
+		props["CCACHE"] = ccache
+	}
+	if authzid != "" {
+		props["AUTHZID"] = authzid
+	}
+	return props
+}
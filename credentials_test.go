@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPasswordProvider(t *testing.T) {
+	const name = "KERB_DEBUG_TEST_PASSWORD"
+	if err := os.Setenv(name, "pencil"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv(name)
+
+	tests := []struct {
+		source string
+		// password is what the provider gives, or empty when the source
+		// is invalid or the provider is not asked.
+		password string
+		valid    bool
+	}{
+		{source: "prompt", valid: true},
+		{source: "env:" + name, password: "pencil", valid: true},
+		{source: "file:/nonexistent/password", valid: true},
+		{source: "cmd:printf %s-%s pen cil", password: "pen-cil", valid: true},
+		{source: "cmd:  printf   pencil  ", password: "pencil", valid: true},
+		{source: "env:"},
+		{source: "file:"},
+		{source: "cmd:"},
+		{source: "cmd:   "},
+		{source: "env"},
+		{source: "pencil"},
+		{source: "literal:pencil"},
+		{source: ""},
+		{source: "PROMPT"},
+	}
+
+	for _, test := range tests {
+		provider, err := passwordProvider(test.source)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%q: expected an error", test.source)
+			} else if !strings.Contains(err.Error(), passwordSources) {
+				t.Errorf("%q: expected the error to list the sources, but got %v", test.source, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.source, err)
+			continue
+		}
+		if test.password == "" || (runtime.GOOS == "windows" && strings.HasPrefix(test.source, "cmd:")) {
+			continue
+		}
+
+		password, err := provider.Password(context.Background())
+		if err != nil {
+			t.Errorf("%q: %v", test.source, err)
+		} else if password != test.password {
+			t.Errorf("%q: expected password %q, but got %q", test.source, test.password, password)
+		}
+	}
+}
+
+func TestMechanismProperties(t *testing.T) {
+	tests := []struct {
+		keytab, ccache, authzid string
+		expected                map[string]string
+	}{
+		{expected: map[string]string{}},
+		{keytab: "/etc/krb5.keytab", expected: map[string]string{"KEYTAB": "/etc/krb5.keytab"}},
+		{
+			keytab:  "/etc/krb5.keytab",
+			ccache:  "MEMORY:test",
+			authzid: "admin@EXAMPLE.COM",
+			expected: map[string]string{
+				"KEYTAB":  "/etc/krb5.keytab",
+				"CCACHE":  "MEMORY:test",
+				"AUTHZID": "admin@EXAMPLE.COM",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		props := mechanismProperties(test.keytab, test.ccache, test.authzid)
+		if !reflect.DeepEqual(props, test.expected) {
+			t.Errorf("expected %v, but got %v", test.expected, props)
+		}
+	}
+}
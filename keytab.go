@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rychipman/kerb-debug/keytab"
+	"github.com/rychipman/kerb-debug/krb5conf"
+)
+
+func runKeytab(args []string) error {
+	fs := flag.NewFlagSet("keytab", flag.ExitOnError)
+	file := fs.String("file", "resources/drivers.keytab", "keytab to inspect")
+	principal := fs.String("principal", "drivers@LDAPTEST.10GEN.CC", "principal which must have keys in the keytab")
+	conf := fs.String("krb5conf", defaultKrb5Config(), "krb5.conf files whose enctype settings the keys must satisfy, separated by "+string(filepath.ListSeparator))
+	expectedKVNO := fs.Uint("expected-kvno", 0, "kvno of the principal's key at the KDC, to look for in the keytab; the KRB-ERROR of a key version mismatch carries it, MIT reports it as \"kvno N not found in keytab\", and kvno(1) prints it")
+	_ = fs.Parse(args)
+
+	kt, err := keytab.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s (version %d, %d entries)\n\n", *file, kt.Version, len(kt.Entries))
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KVNO\tTIMESTAMP\tENCTYPE\tPRINCIPAL")
+	for _, e := range kt.Entries {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", e.KVNO, e.Timestamp.Format(time.RFC3339), e.Enctype, e.Principal)
+	}
+	_ = w.Flush()
+	fmt.Println()
+
+	var errors int
+	report := func(severity krb5conf.Severity, format string, args ...interface{}) {
+		fmt.Printf("%s: %s\n", severity, fmt.Sprintf(format, args...))
+		if severity == krb5conf.Error {
+			errors++
+		}
+	}
+
+	entries := kt.Find(*principal)
+	if len(entries) == 0 {
+		report(krb5conf.Error, "there are no keys for %s", *principal)
+		return fmt.Errorf("%d errors", errors)
+	}
+
+	enctypes := make([]krb5conf.Enctype, 0, len(entries))
+	kvnos := make(map[uint32]bool)
+	for _, e := range entries {
+		enctypes = append(enctypes, e.Enctype)
+		kvnos[e.KVNO] = true
+	}
+
+	config, err := krb5conf.Load(filepath.SplitList(*conf)...)
+	if err != nil {
+		report(krb5conf.Warning, "the enctypes are not checked, unable to read the krb5.conf: %v", err)
+	} else {
+		for _, p := range config.Check(krb5conf.Target{Principal: *principal, KeytabEnctypes: enctypes}) {
+			fmt.Println(p)
+			if p.Severity == krb5conf.Error {
+				errors++
+			}
+		}
+	}
+
+	if *expectedKVNO != 0 && !kvnos[uint32(*expectedKVNO)] {
+		var have []int
+		for kvno := range kvnos {
+			have = append(have, int(kvno))
+		}
+		sort.Ints(have)
+		report(krb5conf.Error, "the KDC expects kvno %d for %s but the keytab has kvno %v, the keytab is out of date", *expectedKVNO, *principal, have)
+	}
+
+	if errors > 0 {
+		return fmt.Errorf("%d errors", errors)
+	}
+
+	fmt.Printf("%d keys for %s, no errors\n", len(entries), *principal)
+	return nil
+}
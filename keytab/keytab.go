@@ -0,0 +1,220 @@
+// Package keytab reads MIT Kerberos keytab files.
+package keytab
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rychipman/kerb-debug/krb5conf"
+)
+
+// Keytab is the content of a keytab file.
+type Keytab struct {
+	Version int
+	Entries []*Entry
+}
+
+// Entry is a key of a principal.
+type Entry struct {
+	Principal Principal
+	Timestamp time.Time
+	KVNO      uint32
+	Enctype   krb5conf.Enctype
+	Key       []byte
+}
+
+// Principal is the name of a principal.
+type Principal struct {
+	Realm      string
+	Components []string
+	NameType   uint32
+}
+
+func (p Principal) String() string {
+	return strings.Join(p.Components, "/") + "@" + p.Realm
+}
+
+// Matches indicates whether p is the principal named name. A name
+// without a realm matches the principal in any realm.
+func (p Principal) Matches(name string) bool {
+	if !strings.Contains(name, "@") {
+		return strings.Join(p.Components, "/") == name
+	}
+	return p.String() == name
+}
+
+// Find gets the entries of the principal named name.
+func (k *Keytab) Find(name string) []*Entry {
+	var entries []*Entry
+	for _, e := range k.Entries {
+		if e.Principal.Matches(name) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// ReadFile reads a keytab file.
+func ReadFile(path string) (*Keytab, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Read(f)
+}
+
+// maxEntrySize guards against reading garbage as an entry size.
+const maxEntrySize = 1 << 16
+
+// Read reads a keytab in the version 1 or 2 format.
+func Read(r io.Reader) (*Keytab, error) {
+	br := bufio.NewReader(r)
+
+	var header [2]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, fmt.Errorf("unable to read keytab header: %v", err)
+	}
+	if header[0] != 5 || (header[1] != 1 && header[1] != 2) {
+		return nil, fmt.Errorf("not a keytab, or an unsupported version: %x", header)
+	}
+
+	k := &Keytab{Version: int(header[1])}
+
+	// version 1 uses the byte order of the machine that wrote it, which
+	// was little endian on every machine still in use.
+	var order binary.ByteOrder = binary.BigEndian
+	if k.Version == 1 {
+		order = binary.LittleEndian
+	}
+
+	for offset := 2; ; {
+		var size int32
+		err := binary.Read(br, order, &size)
+		if err == io.EOF {
+			return k, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the size of the entry at %d: %v", offset, err)
+		}
+
+		length := abs(size)
+		if length > maxEntrySize {
+			return nil, fmt.Errorf("the entry at %d is %d bytes, which is too large for a keytab entry", offset, length)
+		}
+
+		record := make([]byte, length)
+		if _, err := io.ReadFull(br, record); err != nil {
+			return nil, fmt.Errorf("unable to read the entry at %d: %v", offset, err)
+		}
+
+		// a negative size is a hole left by a deleted entry.
+		if size > 0 {
+			e, err := readEntry(record, order, k.Version)
+			if err != nil {
+				return nil, fmt.Errorf("invalid entry at %d: %v", offset, err)
+			}
+			k.Entries = append(k.Entries, e)
+		}
+
+		offset += 4 + len(record)
+	}
+}
+
+func readEntry(record []byte, order binary.ByteOrder, version int) (*Entry, error) {
+	r := bytes.NewReader(record)
+	read := func(v interface{}) error {
+		return binary.Read(r, order, v)
+	}
+	readString := func() (string, error) {
+		var n uint16
+		if err := read(&n); err != nil {
+			return "", err
+		}
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return string(b), err
+	}
+
+	var count uint16
+	if err := read(&count); err != nil {
+		return nil, err
+	}
+	// version 1 counts the realm as a component.
+	if version == 1 {
+		count--
+	}
+
+	e := &Entry{}
+	var err error
+	if e.Principal.Realm, err = readString(); err != nil {
+		return nil, err
+	}
+	for i := 0; i < int(count); i++ {
+		component, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		e.Principal.Components = append(e.Principal.Components, component)
+	}
+	if version != 1 {
+		if err := read(&e.Principal.NameType); err != nil {
+			return nil, err
+		}
+	}
+
+	var timestamp uint32
+	var kvno8 uint8
+	var enctype uint16
+	if err := read(&timestamp); err != nil {
+		return nil, err
+	}
+	if err := read(&kvno8); err != nil {
+		return nil, err
+	}
+	if err := read(&enctype); err != nil {
+		return nil, err
+	}
+	e.Timestamp = time.Unix(int64(timestamp), 0)
+	e.KVNO = uint32(kvno8)
+	e.Enctype = krb5conf.Enctype(enctype)
+
+	var keyLen uint16
+	if err := read(&keyLen); err != nil {
+		return nil, err
+	}
+	e.Key = make([]byte, keyLen)
+	if _, err := io.ReadFull(r, e.Key); err != nil {
+		return nil, err
+	}
+
+	// newer writers add the full 32 bit kvno, which replaces the 8 bit
+	// one unless it is zero.
+	if r.Len() >= 4 {
+		var kvno uint32
+		if err := read(&kvno); err != nil {
+			return nil, err
+		}
+		if kvno != 0 {
+			e.KVNO = kvno
+		}
+	}
+
+	return e, nil
+}
+
+// abs gets the absolute value of n as an int64, which unlike an int32
+// can hold that of math.MinInt32.
+func abs(n int32) int64 {
+	if n < 0 {
+		return -int64(n)
+	}
+	return int64(n)
+}
@@ -0,0 +1,216 @@
+package keytab
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rychipman/kerb-debug/krb5conf"
+)
+
+// entry encodes a keytab entry of principal in the format of version,
+// with a 32 bit kvno when kvno is not 0.
+func entry(version int, principal Principal, enctype krb5conf.Enctype, kvno8 uint8, kvno uint32) []byte {
+	var order binary.ByteOrder = binary.BigEndian
+	if version == 1 {
+		order = binary.LittleEndian
+	}
+
+	var b bytes.Buffer
+	write := func(v interface{}) {
+		_ = binary.Write(&b, order, v)
+	}
+	writeString := func(s string) {
+		write(uint16(len(s)))
+		b.WriteString(s)
+	}
+
+	count := uint16(len(principal.Components))
+	if version == 1 {
+		count++
+	}
+	write(count)
+	writeString(principal.Realm)
+	for _, component := range principal.Components {
+		writeString(component)
+	}
+	if version != 1 {
+		write(principal.NameType)
+	}
+	write(uint32(1485280469))
+	write(kvno8)
+	write(uint16(enctype))
+	writeString("0123456789abcdef")
+	if kvno != 0 {
+		write(kvno)
+	}
+
+	record := b.Bytes()
+	b = bytes.Buffer{}
+	write(int32(len(record)))
+	b.Write(record)
+	return b.Bytes()
+}
+
+func keytab(version int, entries ...[]byte) []byte {
+	return append([]byte{5, byte(version)}, bytes.Join(entries, nil)...)
+}
+
+func TestReadFile(t *testing.T) {
+	k, err := ReadFile("../resources/drivers.keytab")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if k.Version != 2 {
+		t.Errorf("expected version 2, but got %d", k.Version)
+	}
+
+	drivers := Principal{Realm: "LDAPTEST.10GEN.CC", Components: []string{"drivers"}, NameType: 1}
+	schrodinger := Principal{Realm: "LDAPTEST.10GEN.CC", Components: []string{"schrödinger"}, NameType: 1}
+	expected := []struct {
+		principal Principal
+		enctype   krb5conf.Enctype
+	}{
+		{drivers, krb5conf.ARCFOURHMAC},
+		{drivers, krb5conf.ARCFOURHMAC},
+		{drivers, krb5conf.AES256CTSHMACSHA196},
+		{schrodinger, krb5conf.AES256CTSHMACSHA196},
+	}
+	if len(k.Entries) != len(expected) {
+		t.Fatalf("expected %d entries, but got %d", len(expected), len(k.Entries))
+	}
+	for i, e := range k.Entries {
+		if !reflect.DeepEqual(e.Principal, expected[i].principal) || e.Enctype != expected[i].enctype || e.KVNO != 1 {
+			t.Errorf("entry %d: expected %v %v kvno 1, but got %v %v kvno %d", i, expected[i].principal, expected[i].enctype, e.Principal, e.Enctype, e.KVNO)
+		}
+		if !e.Timestamp.Equal(time.Unix(1485280469, 0)) {
+			t.Errorf("entry %d: unexpected timestamp %v", i, e.Timestamp)
+		}
+	}
+
+	if entries := k.Find("drivers"); len(entries) != 3 {
+		t.Errorf("expected 3 entries of drivers, but got %d", len(entries))
+	}
+	if entries := k.Find("schrödinger@LDAPTEST.10GEN.CC"); len(entries) != 1 {
+		t.Errorf("expected 1 entry of schrödinger@LDAPTEST.10GEN.CC, but got %d", len(entries))
+	}
+	if entries := k.Find("drivers@OTHER.REALM"); len(entries) != 0 {
+		t.Errorf("expected no entries of drivers@OTHER.REALM, but got %d", len(entries))
+	}
+}
+
+func TestRead(t *testing.T) {
+	principal := Principal{Realm: "EXAMPLE.COM", Components: []string{"mongodb", "db.example.com"}, NameType: 3}
+	v1 := principal
+	v1.NameType = 0
+
+	hole := entry(2, principal, krb5conf.AES128CTSHMACSHA196, 1, 0)
+	binary.BigEndian.PutUint32(hole, uint32(-int32(len(hole)-4)))
+
+	tests := []struct {
+		name      string
+		keytab    []byte
+		principal Principal
+		kvnos     []uint32
+	}{
+		{
+			name:      "v1",
+			keytab:    keytab(1, entry(1, v1, krb5conf.AES256CTSHMACSHA196, 3, 0)),
+			principal: v1,
+			kvnos:     []uint32{3},
+		},
+		{
+			name:      "v2",
+			keytab:    keytab(2, entry(2, principal, krb5conf.AES256CTSHMACSHA196, 3, 0)),
+			principal: principal,
+			kvnos:     []uint32{3},
+		},
+		{
+			name:      "32 bit kvno",
+			keytab:    keytab(2, entry(2, principal, krb5conf.AES256CTSHMACSHA196, 4, 260)),
+			principal: principal,
+			kvnos:     []uint32{260},
+		},
+		{
+			name:      "zero 32 bit kvno",
+			keytab:    keytab(2, entry(2, principal, krb5conf.AES256CTSHMACSHA196, 4, 0), []byte{0, 0, 0, 0}),
+			principal: principal,
+			kvnos:     []uint32{4},
+		},
+		{
+			name: "hole",
+			keytab: keytab(2,
+				entry(2, principal, krb5conf.AES256CTSHMACSHA196, 1, 0),
+				hole,
+				entry(2, principal, krb5conf.AES256CTSHMACSHA196, 2, 0),
+			),
+			principal: principal,
+			kvnos:     []uint32{1, 2},
+		},
+		{
+			name:   "empty",
+			keytab: keytab(2),
+		},
+	}
+
+	for _, test := range tests {
+		k, err := Read(bytes.NewReader(test.keytab))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		var kvnos []uint32
+		for _, e := range k.Entries {
+			kvnos = append(kvnos, e.KVNO)
+			if !reflect.DeepEqual(e.Principal, test.principal) {
+				t.Errorf("%s: expected %+v, but got %+v", test.name, test.principal, e.Principal)
+			}
+			if e.Enctype != krb5conf.AES256CTSHMACSHA196 || string(e.Key) != "0123456789abcdef" {
+				t.Errorf("%s: unexpected key %v %q", test.name, e.Enctype, e.Key)
+			}
+		}
+		if !reflect.DeepEqual(kvnos, test.kvnos) {
+			t.Errorf("%s: expected kvnos %v, but got %v", test.name, test.kvnos, kvnos)
+		}
+	}
+}
+
+func TestRead_errors(t *testing.T) {
+	principal := Principal{Realm: "EXAMPLE.COM", Components: []string{"user"}, NameType: 1}
+	valid := entry(2, principal, krb5conf.AES256CTSHMACSHA196, 1, 0)
+
+	// a record which claims more components than it has.
+	short := entry(2, principal, krb5conf.AES256CTSHMACSHA196, 1, 0)
+	short[5] = 9
+
+	tests := []struct {
+		name   string
+		keytab []byte
+		err    string
+	}{
+		{"no header", []byte{5}, "unable to read keytab header"},
+		{"not a keytab", []byte{4, 2}, "not a keytab, or an unsupported version: 0402"},
+		{"unsupported version", []byte{5, 3}, "not a keytab, or an unsupported version: 0503"},
+		{"truncated size", keytab(2, valid, []byte{0, 0}), "unable to read the size of the entry at 56"},
+		{"truncated entry", keytab(2, valid[:len(valid)-3]), "unable to read the entry at 2: unexpected EOF"},
+		{"truncated record", keytab(2, short), "invalid entry at 2"},
+		{"too large", []byte{5, 2, 0, 1, 0, 1}, "the entry at 2 is 65537 bytes, which is too large"},
+		{"too large hole", []byte{5, 2, 0xff, 0xfe, 0xff, 0xff}, "the entry at 2 is 65537 bytes, which is too large"},
+		{"smallest size", []byte{5, 2, 0x80, 0, 0, 0}, "the entry at 2 is 2147483648 bytes, which is too large"},
+		{"smallest v1 size", []byte{5, 1, 0, 0, 0, 0x80}, "the entry at 2 is 2147483648 bytes, which is too large"},
+	}
+
+	for _, test := range tests {
+		_, err := Read(bytes.NewReader(test.keytab))
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing %q, but got %v", test.name, test.err, err)
+		}
+	}
+}
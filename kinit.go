@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/10gen/mongo-go-driver/mongo/private/auth"
+)
+
+func runKinit(args []string) error {
+	fs := flag.NewFlagSet("kinit", flag.ExitOnError)
+	username := fs.String("username", "drivers@LDAPTEST.10GEN.CC", "kerberos principal to get a ticket for")
+	passwordFrom := fs.String("password-from", "prompt", "where to get the principal's password: "+passwordSources)
+	keytab := fs.String("keytab", "", "keytab to get the ticket with instead of the password")
+	ccache := fs.String("ccache", "", "credential cache to store the ticket in, e.g. FILE:/tmp/krb5cc_test, instead of the default one")
+	_ = fs.Parse(args)
+
+	var password string
+	if *keytab == "" {
+		provider, err := passwordProvider(*passwordFrom)
+		if err != nil {
+			return err
+		}
+		password, err = provider.Password(context.Background())
+		if err != nil {
+			return err
+		}
+	}
+
+	lifetime, err := auth.AcquireCredentials(*username, password, *keytab, *ccache)
+	if err != nil {
+		printRemediation(err)
+		return err
+	}
+
+	where := *ccache
+	if where == "" {
+		where = "the default credential cache"
+	}
+	fmt.Printf("stored a ticket for %s in %s, valid until %s\n", *username, where, time.Now().Add(lifetime).Format(time.RFC1123))
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/10gen/mongo-go-driver/mongo/connstring"
+	"github.com/rychipman/kerb-debug/krb5conf"
+)
+
+func runKrb5Conf(args []string) error {
+	fs := flag.NewFlagSet("krb5conf", flag.ExitOnError)
+	file := fs.String("file", defaultKrb5Config(), "krb5.conf files to check, separated by "+string(filepath.ListSeparator))
+	uri := fs.String("uri", "mongodb://ldaptest.10gen.cc:27017", "mongodb uri of the server to check the configuration for, only the first host is used")
+	username := fs.String("username", "drivers@LDAPTEST.10GEN.CC", "kerberos principal to check the configuration for")
+	_ = fs.Parse(args)
+
+	cs, err := connstring.Parse(*uri)
+	if err != nil {
+		return err
+	}
+	host := cs.Hosts[0]
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	config, err := krb5conf.Load(filepath.SplitList(*file)...)
+	if err != nil {
+		return err
+	}
+
+	return checkKrb5Conf(config, krb5conf.Target{Host: host, Principal: *username})
+}
+
+// checkKrb5Conf prints how the configuration resolves the target and
+// the problems it has.
+func checkKrb5Conf(config *krb5conf.Config, target krb5conf.Target) error {
+	fmt.Printf("read %s\n", strings.Join(config.Profile.Files, ", "))
+
+	res := config.Resolve(target.Host, target.Principal)
+	fmt.Printf("principal realm: %s (%s)\n", valueOrNone(res.PrincipalRealm), res.PrincipalRealmFrom)
+	fmt.Printf("host realm:      %s (%s)\n", valueOrNone(res.HostRealm), res.HostRealmFrom)
+	if res.PrincipalRealm != res.HostRealm {
+		fmt.Printf("path:            %s (%s)\n", strings.Join(res.Realms(), " -> "), res.PathFrom)
+	}
+	for _, name := range res.Realms() {
+		kdcs := "none configured"
+		if realm, ok := config.Realms[name]; ok && len(realm.KDCs) > 0 {
+			kdcs = strings.Join(realm.KDCs, ", ")
+		}
+		fmt.Printf("kdcs of %s: %s\n", name, kdcs)
+	}
+
+	var errors int
+	problems := config.Check(target)
+	if len(problems) > 0 {
+		fmt.Println()
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+		if p.Severity == krb5conf.Error {
+			errors++
+		}
+	}
+
+	if errors > 0 {
+		return fmt.Errorf("%d errors", errors)
+	}
+
+	fmt.Println()
+	fmt.Println("no errors")
+	return nil
+}
+
+// defaultKrb5Config gets the configuration files the Kerberos library uses.
+func defaultKrb5Config() string {
+	if files := os.Getenv("KRB5_CONFIG"); files != "" {
+		return files
+	}
+	return "/etc/krb5.conf"
+}
+
+func valueOrNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
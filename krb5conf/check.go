@@ -0,0 +1,165 @@
+package krb5conf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Severity is how serious a Problem is.
+type Severity uint8
+
+// Severity constants.
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return "unknown severity"
+}
+
+// Problem is something in the configuration which will likely stop a
+// client from authenticating.
+type Problem struct {
+	Severity Severity
+	// Pos is where the problem is, if it is at a particular line.
+	Pos     Pos
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Pos.File == "" {
+		return fmt.Sprintf("%s: %s", p.Severity, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.Pos, p.Severity, p.Message)
+}
+
+// Target is what a configuration is checked for.
+type Target struct {
+	Host      string
+	Principal string
+	// KeytabEnctypes are the enctypes of the principal's keys in its
+	// keytab. The enctypes are not checked when it is nil.
+	KeytabEnctypes []Enctype
+}
+
+// Check reports the problems of the configuration for the target.
+func (c *Config) Check(t Target) []Problem {
+	problems := append([]Problem{}, c.problems...)
+	add := func(severity Severity, pos Pos, format string, args ...interface{}) {
+		problems = append(problems, Problem{
+			Severity: severity,
+			Pos:      pos,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	res := c.Resolve(t.Host, t.Principal)
+
+	if res.PrincipalRealm == "" {
+		add(Error, Pos{}, "principal %s has no realm and there is no default_realm", t.Principal)
+	}
+
+	if t.Host != "" {
+		if _, _, ok := c.HostRealm(t.Host); !ok {
+			add(Warning, Pos{}, "no domain_realm mapping for %s, the service ticket is requested from %s and relies on a referral", t.Host, res.PrincipalRealm)
+		}
+	}
+
+	for _, realm := range res.Realms() {
+		r, ok := c.Realms[realm]
+		if !ok || len(r.KDCs) == 0 {
+			if !c.LibDefaults.DNSLookupKDC {
+				add(Error, Pos{}, "realm %s has no kdc in [realms] and dns_lookup_kdc is off", realm)
+				continue
+			}
+			if _, addrs, err := c.resolver().LookupSRV(context.Background(), "kerberos", "udp", realm); err != nil || len(addrs) == 0 {
+				add(Error, Pos{}, "realm %s has no kdc in [realms] and no _kerberos._udp.%s SRV record", realm, realm)
+			}
+			continue
+		}
+
+		for _, kdc := range r.KDCs {
+			host := kdcHost(kdc)
+			if _, err := c.resolver().LookupHost(context.Background(), host); err != nil {
+				add(Error, r.Pos, "kdc %s of realm %s cannot be resolved: %v", host, realm, err)
+			}
+		}
+	}
+
+	if rdns := c.Profile.Find("libdefaults", "rdns"); rdns != nil && c.LibDefaults.RDNS {
+		switch c.LibDefaults.DNSCanonicalizeHostname {
+		case "false":
+			add(Warning, rdns.Pos, "rdns = %s has no effect because dns_canonicalize_hostname is false", rdns.Value)
+		case "fallback":
+			add(Warning, rdns.Pos, "rdns = %s only applies when dns_canonicalize_hostname = fallback falls back to canonicalizing", rdns.Value)
+		}
+	}
+
+	if t.KeytabEnctypes != nil {
+		permitted := Pos{}
+		if r := c.Profile.Find("libdefaults", "permitted_enctypes"); r != nil {
+			permitted = r.Pos
+		}
+		for _, e := range t.KeytabEnctypes {
+			if !containsEnctype(c.LibDefaults.PermittedEnctypes, e) {
+				add(Warning, permitted, "%s keys are not permitted by permitted_enctypes", e)
+			}
+		}
+
+		var usable []Enctype
+		for _, e := range t.KeytabEnctypes {
+			if containsEnctype(c.LibDefaults.DefaultTktEnctypes, e) && containsEnctype(c.LibDefaults.PermittedEnctypes, e) {
+				usable = append(usable, e)
+			}
+		}
+
+		if len(usable) == 0 {
+			pos := Pos{}
+			if r := c.Profile.Find("libdefaults", "default_tkt_enctypes"); r != nil {
+				pos = r.Pos
+			}
+			add(Error, pos, "no keytab entry has a permitted default_tkt_enctypes enctype, the keytab has %s but the configuration allows %s",
+				enctypeList(t.KeytabEnctypes), enctypeList(c.LibDefaults.DefaultTktEnctypes))
+		}
+	}
+
+	return problems
+}
+
+// problemAt records a problem found while reading the configuration.
+func (c *Config) problemAt(r *Relation, severity Severity, format string, args ...interface{}) {
+	p := Problem{
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	if r != nil {
+		p.Pos = r.Pos
+	}
+	c.problems = append(c.problems, p)
+}
+
+// kdcHost removes the port from a kdc setting.
+func kdcHost(kdc string) string {
+	if host, _, err := net.SplitHostPort(kdc); err == nil {
+		return host
+	}
+	return strings.Trim(kdc, "[]")
+}
+
+func containsEnctype(enctypes []Enctype, e Enctype) bool {
+	for _, x := range enctypes {
+		if x == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+// Package krb5conf reads and checks the MIT Kerberos configuration
+// file, krb5.conf.
+package krb5conf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Config is the part of a krb5.conf which decides how a client finds
+// the realm and KDCs for a host and which enctypes it uses.
+type Config struct {
+	Profile *Profile
+
+	LibDefaults LibDefaults
+	Realms      map[string]*Realm
+	// DomainRealm maps host names, or domains when they start with a
+	// dot, to realms.
+	DomainRealm map[string]string
+	// CAPaths maps a client realm and a server realm to the
+	// intermediate realms between them.
+	CAPaths map[string]map[string][]string
+
+	// Resolver looks up the KDCs when the configuration is checked. It
+	// is net.DefaultResolver when nil.
+	Resolver Resolver
+
+	// problems are found while reading the configuration.
+	problems []Problem
+}
+
+// Resolver looks up names in the DNS. It is implemented by *net.Resolver.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// LibDefaults are the settings of the [libdefaults] section.
+type LibDefaults struct {
+	DefaultRealm            string
+	DNSLookupKDC            bool
+	DNSLookupRealm          bool
+	DNSCanonicalizeHostname string
+	RDNS                    bool
+	AllowWeakCrypto         bool
+	DefaultTktEnctypes      []Enctype
+	DefaultTGSEnctypes      []Enctype
+	PermittedEnctypes       []Enctype
+}
+
+// Realm is a realm of the [realms] section.
+type Realm struct {
+	Name          string
+	KDCs          []string
+	AdminServers  []string
+	DefaultDomain string
+	Pos           Pos
+}
+
+// Load reads and interprets krb5.conf files and the files they include.
+// Several files are merged like the MIT library merges the files listed
+// in KRB5_CONFIG, the settings of the first file win.
+func Load(paths ...string) (*Config, error) {
+	p := &Profile{}
+	for _, path := range paths {
+		if err := p.parseFile(path, 0); err != nil {
+			return nil, err
+		}
+	}
+	return New(p), nil
+}
+
+// New interprets a parsed configuration.
+func New(p *Profile) *Config {
+	c := &Config{
+		Profile:     p,
+		Realms:      make(map[string]*Realm),
+		DomainRealm: make(map[string]string),
+		CAPaths:     make(map[string]map[string][]string),
+	}
+
+	c.readLibDefaults()
+	c.readRealms()
+
+	for _, r := range p.Relations("domain_realm") {
+		domain := strings.ToLower(r.Tag)
+		if _, ok := c.DomainRealm[domain]; !ok {
+			c.DomainRealm[domain] = r.Value
+		}
+	}
+
+	for _, client := range p.Relations("capaths") {
+		paths, ok := c.CAPaths[client.Tag]
+		if !ok {
+			paths = make(map[string][]string)
+			c.CAPaths[client.Tag] = paths
+		}
+		for _, server := range client.Sub {
+			if server.Value != "" && server.Value != "." {
+				paths[server.Tag] = append(paths[server.Tag], server.Value)
+			} else if _, ok := paths[server.Tag]; !ok {
+				// a direct path.
+				paths[server.Tag] = []string{}
+			}
+		}
+	}
+
+	return c
+}
+
+func (c *Config) readLibDefaults() {
+	d := &c.LibDefaults
+	d.DefaultRealm = c.libDefault("default_realm", "")
+	d.DNSLookupKDC = c.libDefaultBool("dns_lookup_kdc", true)
+	d.DNSLookupRealm = c.libDefaultBool("dns_lookup_realm", false)
+	d.RDNS = c.libDefaultBool("rdns", true)
+	d.AllowWeakCrypto = c.libDefaultBool("allow_weak_crypto", false)
+
+	d.DNSCanonicalizeHostname = strings.ToLower(c.libDefault("dns_canonicalize_hostname", "true"))
+	switch d.DNSCanonicalizeHostname {
+	case "fallback":
+	default:
+		if b, ok := parseBool(d.DNSCanonicalizeHostname); ok {
+			d.DNSCanonicalizeHostname = fmt.Sprint(b)
+		} else {
+			c.problemAt(c.Profile.Find("libdefaults", "dns_canonicalize_hostname"), Error,
+				"dns_canonicalize_hostname must be true, false or fallback, not %q", d.DNSCanonicalizeHostname)
+			d.DNSCanonicalizeHostname = "true"
+		}
+	}
+
+	d.PermittedEnctypes = c.libDefaultEnctypes("permitted_enctypes", defaultEnctypes)
+	d.DefaultTktEnctypes = c.libDefaultEnctypes("default_tkt_enctypes", d.PermittedEnctypes)
+	d.DefaultTGSEnctypes = c.libDefaultEnctypes("default_tgs_enctypes", d.PermittedEnctypes)
+}
+
+func (c *Config) readRealms() {
+	for _, r := range c.Profile.Relations("realms") {
+		realm, ok := c.Realms[r.Tag]
+		if !ok {
+			realm = &Realm{Name: r.Tag, Pos: r.Pos}
+			c.Realms[r.Tag] = realm
+		}
+		if r.Sub == nil {
+			c.problemAt(r, Error, "realm %s must be a { ... } section", r.Tag)
+			continue
+		}
+
+		for _, setting := range r.Sub {
+			switch setting.Tag {
+			case "kdc":
+				realm.KDCs = append(realm.KDCs, setting.Value)
+			case "admin_server":
+				realm.AdminServers = append(realm.AdminServers, setting.Value)
+			case "default_domain":
+				if realm.DefaultDomain == "" {
+					realm.DefaultDomain = setting.Value
+				}
+			}
+		}
+	}
+}
+
+func (c *Config) resolver() Resolver {
+	if c.Resolver == nil {
+		return net.DefaultResolver
+	}
+	return c.Resolver
+}
+
+// RealmNames gets the names of the realms in the [realms] section.
+func (c *Config) RealmNames() []string {
+	var names []string
+	for name := range c.Realms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Config) libDefault(tag, def string) string {
+	if r := c.Profile.Find("libdefaults", tag); r != nil {
+		return r.Value
+	}
+	return def
+}
+
+func (c *Config) libDefaultBool(tag string, def bool) bool {
+	r := c.Profile.Find("libdefaults", tag)
+	if r == nil {
+		return def
+	}
+
+	b, ok := parseBool(r.Value)
+	if !ok {
+		c.problemAt(r, Error, "%s must be a boolean, not %q", tag, r.Value)
+		return def
+	}
+	return b
+}
+
+func (c *Config) libDefaultEnctypes(tag string, def []Enctype) []Enctype {
+	r := c.Profile.Find("libdefaults", tag)
+	if r == nil {
+		return def
+	}
+
+	enctypes, unknown := parseEnctypeList(r.Value, c.LibDefaults.AllowWeakCrypto)
+	for _, name := range unknown {
+		c.problemAt(r, Warning, "%s contains the unknown enctype %s", tag, name)
+	}
+	if len(enctypes) == 0 {
+		c.problemAt(r, Error, "%s does not leave any usable enctype", tag)
+	}
+	return enctypes
+}
+
+// parseBool parses the booleans the MIT library accepts.
+func parseBool(s string) (bool, bool) {
+	switch strings.ToLower(s) {
+	case "y", "yes", "true", "t", "1", "on":
+		return true, true
+	case "n", "no", "false", "nil", "0", "off":
+		return false, true
+	}
+	return false, false
+}
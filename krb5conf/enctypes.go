@@ -0,0 +1,159 @@
+package krb5conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Enctype is a Kerberos encryption type number.
+type Enctype int32
+
+// Enctype constants.
+const (
+	DESCBCCRC              Enctype = 1
+	DESCBCMD4              Enctype = 2
+	DESCBCMD5              Enctype = 3
+	DES3CBCSHA1            Enctype = 16
+	AES128CTSHMACSHA196    Enctype = 17
+	AES256CTSHMACSHA196    Enctype = 18
+	AES128CTSHMACSHA256128 Enctype = 19
+	AES256CTSHMACSHA384192 Enctype = 20
+	ARCFOURHMAC            Enctype = 23
+	ARCFOURHMACEXP         Enctype = 24
+	CAMELLIA128CTSCMAC     Enctype = 25
+	CAMELLIA256CTSCMAC     Enctype = 26
+)
+
+var enctypeNames = map[Enctype]string{
+	DESCBCCRC:              "des-cbc-crc",
+	DESCBCMD4:              "des-cbc-md4",
+	DESCBCMD5:              "des-cbc-md5",
+	DES3CBCSHA1:            "des3-cbc-sha1",
+	AES128CTSHMACSHA196:    "aes128-cts-hmac-sha1-96",
+	AES256CTSHMACSHA196:    "aes256-cts-hmac-sha1-96",
+	AES128CTSHMACSHA256128: "aes128-cts-hmac-sha256-128",
+	AES256CTSHMACSHA384192: "aes256-cts-hmac-sha384-192",
+	ARCFOURHMAC:            "arcfour-hmac",
+	ARCFOURHMACEXP:         "arcfour-hmac-exp",
+	CAMELLIA128CTSCMAC:     "camellia128-cts-cmac",
+	CAMELLIA256CTSCMAC:     "camellia256-cts-cmac",
+}
+
+func (e Enctype) String() string {
+	if name, ok := enctypeNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("enctype-%d", int32(e))
+}
+
+// Weak indicates whether the enctype is only permitted with
+// allow_weak_crypto.
+func (e Enctype) Weak() bool {
+	switch e {
+	case DESCBCCRC, DESCBCMD4, DESCBCMD5, ARCFOURHMACEXP:
+		return true
+	}
+	return false
+}
+
+// enctypeAliases are the other names the MIT library accepts.
+var enctypeAliases = map[string]Enctype{
+	"des3-hmac-sha1":   DES3CBCSHA1,
+	"des3-cbc-sha1-kd": DES3CBCSHA1,
+	"aes128-cts":       AES128CTSHMACSHA196,
+	"aes128-sha1":      AES128CTSHMACSHA196,
+	"aes256-cts":       AES256CTSHMACSHA196,
+	"aes256-sha1":      AES256CTSHMACSHA196,
+	"aes128-sha2":      AES128CTSHMACSHA256128,
+	"aes256-sha2":      AES256CTSHMACSHA384192,
+	"arcfour-hmac-md5": ARCFOURHMAC,
+	"rc4-hmac":         ARCFOURHMAC,
+	"arcfour-hmac-exp": ARCFOURHMACEXP,
+	"rc4-hmac-exp":     ARCFOURHMACEXP,
+	"camellia128-cts":  CAMELLIA128CTSCMAC,
+	"camellia256-cts":  CAMELLIA256CTSCMAC,
+}
+
+// enctypeFamilies are the names which stand for several enctypes.
+var enctypeFamilies = map[string][]Enctype{
+	"des":      {DESCBCCRC, DESCBCMD5, DESCBCMD4},
+	"des3":     {DES3CBCSHA1},
+	"rc4":      {ARCFOURHMAC},
+	"aes":      {AES256CTSHMACSHA196, AES128CTSHMACSHA196, AES256CTSHMACSHA384192, AES128CTSHMACSHA256128},
+	"camellia": {CAMELLIA256CTSCMAC, CAMELLIA128CTSCMAC},
+}
+
+// defaultEnctypes is what DEFAULT and an unset enctype list mean.
+var defaultEnctypes = []Enctype{
+	AES256CTSHMACSHA196,
+	AES128CTSHMACSHA196,
+	AES256CTSHMACSHA384192,
+	AES128CTSHMACSHA256128,
+	DES3CBCSHA1,
+	ARCFOURHMAC,
+	CAMELLIA128CTSCMAC,
+	CAMELLIA256CTSCMAC,
+}
+
+// ParseEnctype gets the enctype for a name or alias.
+func ParseEnctype(name string) (Enctype, bool) {
+	name = strings.ToLower(name)
+	for e, n := range enctypeNames {
+		if n == name {
+			return e, true
+		}
+	}
+	e, ok := enctypeAliases[name]
+	return e, ok
+}
+
+// parseEnctypeList expands an enctype list the way the MIT library does:
+// families and DEFAULT are expanded, a name prefixed with - is removed
+// and, unless allowWeak is set, weak enctypes are dropped. The names that
+// are not recognized are returned separately.
+func parseEnctypeList(list string, allowWeak bool) (enctypes []Enctype, unknown []string) {
+	has := func(e Enctype) int {
+		for i, x := range enctypes {
+			if x == e {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for _, name := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+		remove := strings.HasPrefix(name, "-")
+		name = strings.TrimLeft(name, "+-")
+
+		var named []Enctype
+		if strings.EqualFold(name, "DEFAULT") {
+			named = defaultEnctypes
+		} else if family, ok := enctypeFamilies[strings.ToLower(name)]; ok {
+			named = family
+		} else if e, ok := ParseEnctype(name); ok {
+			named = []Enctype{e}
+		} else {
+			unknown = append(unknown, name)
+			continue
+		}
+
+		for _, e := range named {
+			i := has(e)
+			switch {
+			case remove && i != -1:
+				enctypes = append(enctypes[:i], enctypes[i+1:]...)
+			case !remove && i == -1 && (allowWeak || !e.Weak()):
+				enctypes = append(enctypes, e)
+			}
+		}
+	}
+	return enctypes, unknown
+}
+
+func enctypeList(enctypes []Enctype) string {
+	names := make([]string, len(enctypes))
+	for i, e := range enctypes {
+		names[i] = e.String()
+	}
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,429 @@
+package krb5conf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeResolver knows the hosts and the realms with _kerberos._udp SRV
+// records in its maps.
+type fakeResolver struct {
+	hosts map[string]bool
+	srv   map[string]bool
+}
+
+func (r *fakeResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	if !r.hosts[host] {
+		return nil, &net.DNSError{Err: "no such host", Name: host}
+	}
+	return []string{"192.0.2.1"}, nil
+}
+
+func (r *fakeResolver) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	target := fmt.Sprintf("_%s._%s.%s", service, proto, name)
+	if !r.srv[name] {
+		return "", nil, &net.DNSError{Err: "no such host", Name: target}
+	}
+	return target, []*net.SRV{{Target: "kdc." + strings.ToLower(name), Port: 88}}, nil
+}
+
+func load(t *testing.T, names ...string) *Config {
+	var paths []string
+	for _, name := range names {
+		paths = append(paths, filepath.Join("testdata", name))
+	}
+	c, err := Load(paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestLoad(t *testing.T) {
+	c := load(t, "krb5.conf")
+
+	files := []string{
+		filepath.Join("testdata", "krb5.conf"),
+		filepath.Join("testdata", "base.conf"),
+		filepath.Join("testdata", "conf.d", "extra"),
+		filepath.Join("testdata", "conf.d", "realms.conf"),
+	}
+	if !reflect.DeepEqual(c.Profile.Files, files) {
+		t.Errorf("expected files %v, but got %v", files, c.Profile.Files)
+	}
+
+	d := c.LibDefaults
+	if d.DefaultRealm != "EXAMPLE.COM" {
+		t.Errorf("expected the default_realm of the first file, but got %s", d.DefaultRealm)
+	}
+	if !d.DNSLookupRealm || d.DNSLookupKDC || !d.RDNS || d.DNSCanonicalizeHostname != "fallback" {
+		t.Errorf("unexpected libdefaults %+v", d)
+	}
+
+	if names := c.RealmNames(); !reflect.DeepEqual(names, []string{"CORP.EXAMPLE.ORG", "DB.EXAMPLE.COM", "EXAMPLE.COM"}) {
+		t.Errorf("unexpected realms %v", names)
+	}
+	r := c.Realms["EXAMPLE.COM"]
+	if !reflect.DeepEqual(r.KDCs, []string{"kdc1.example.com:88", "kdc2.example.com"}) ||
+		!reflect.DeepEqual(r.AdminServers, []string{"kdc1.example.com"}) ||
+		r.DefaultDomain != "example.com" {
+		t.Errorf("unexpected realm %+v", r)
+	}
+	if r.Pos.File != files[0] || r.Pos.Line != 6 {
+		t.Errorf("expected the realm at %s:6, but it is at %s", files[0], r.Pos)
+	}
+
+	if len(c.problems) != 1 || !strings.Contains(c.problems[0].Message, "unknown enctype blowfish") {
+		t.Errorf("expected a problem with the unknown enctype, but got %v", c.problems)
+	}
+}
+
+func TestLoad_errors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{"loop.conf", "includes are nested more than 16 deep"},
+		{"missing.conf", "missing.conf:4: open " + filepath.Join("testdata", "nonexistent.conf")},
+		{"unclosed.conf", "unclosed.conf:2: EXAMPLE.COM is never closed"},
+		{"nonexistent.conf", "no such file or directory"},
+	}
+
+	for _, test := range tests {
+		_, err := Load(filepath.Join("testdata", test.name))
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing %q, but got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestLoad_invalid_values(t *testing.T) {
+	c := load(t, "invalid.conf")
+
+	expected := []string{
+		"testdata/invalid.conf:2: error: dns_lookup_kdc must be a boolean, not \"perhaps\"",
+		"testdata/invalid.conf:3: error: dns_canonicalize_hostname must be true, false or fallback, not \"sometimes\"",
+		"testdata/invalid.conf:4: warning: default_tkt_enctypes contains the unknown enctype rot13",
+		"testdata/invalid.conf:4: error: default_tkt_enctypes does not leave any usable enctype",
+		"testdata/invalid.conf:7: error: realm EXAMPLE.COM must be a { ... } section",
+	}
+	var problems []string
+	for _, p := range c.problems {
+		problems = append(problems, filepath.ToSlash(p.String()))
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("expected problems\n%s\nbut got\n%s", strings.Join(expected, "\n"), strings.Join(problems, "\n"))
+	}
+
+	// the defaults are used instead of the invalid values.
+	if !c.LibDefaults.DNSLookupKDC || c.LibDefaults.DNSCanonicalizeHostname != "true" {
+		t.Errorf("unexpected libdefaults %+v", c.LibDefaults)
+	}
+}
+
+func TestParseEnctypeList(t *testing.T) {
+	tests := []struct {
+		list      string
+		allowWeak bool
+		enctypes  []Enctype
+		unknown   []string
+	}{
+		{
+			list:     "DEFAULT -des3 -rc4 -camellia",
+			enctypes: []Enctype{AES256CTSHMACSHA196, AES128CTSHMACSHA196, AES256CTSHMACSHA384192, AES128CTSHMACSHA256128},
+		},
+		{
+			list:     "aes256-cts aes128-sha2,+rc4-hmac",
+			enctypes: []Enctype{AES256CTSHMACSHA196, AES128CTSHMACSHA256128, ARCFOURHMAC},
+		},
+		{
+			// a removal only removes what is already there.
+			list:     "-aes128-cts aes",
+			enctypes: []Enctype{AES256CTSHMACSHA196, AES128CTSHMACSHA196, AES256CTSHMACSHA384192, AES128CTSHMACSHA256128},
+		},
+		{
+			list:     "aes -aes",
+			enctypes: []Enctype{},
+		},
+		{
+			list:     "des des3",
+			enctypes: []Enctype{DES3CBCSHA1},
+		},
+		{
+			list:      "des des3",
+			allowWeak: true,
+			enctypes:  []Enctype{DESCBCCRC, DESCBCMD5, DESCBCMD4, DES3CBCSHA1},
+		},
+		{
+			list:     "default AES256-CTS-HMAC-SHA1-96 -arcfour-hmac -des3-hmac-sha1 -camellia128-cts -camellia256-cts",
+			enctypes: []Enctype{AES256CTSHMACSHA196, AES128CTSHMACSHA196, AES256CTSHMACSHA384192, AES128CTSHMACSHA256128},
+		},
+		{
+			list:     "aes256-cts blowfish -rot13",
+			enctypes: []Enctype{AES256CTSHMACSHA196},
+			unknown:  []string{"blowfish", "rot13"},
+		},
+	}
+
+	for _, test := range tests {
+		enctypes, unknown := parseEnctypeList(test.list, test.allowWeak)
+		if !reflect.DeepEqual(enctypes, test.enctypes) {
+			t.Errorf("%q: expected %v, but got %v", test.list, test.enctypes, enctypes)
+		}
+		if !reflect.DeepEqual(unknown, test.unknown) {
+			t.Errorf("%q: expected unknown %v, but got %v", test.list, test.unknown, unknown)
+		}
+	}
+
+	// DEFAULT is the same as not setting the list.
+	c := load(t, "krb5.conf")
+	if !reflect.DeepEqual(c.LibDefaults.DefaultTktEnctypes, tests[0].enctypes) {
+		t.Errorf("unexpected default_tkt_enctypes %v", c.LibDefaults.DefaultTktEnctypes)
+	}
+	permitted := []Enctype{AES256CTSHMACSHA196, AES128CTSHMACSHA196, AES256CTSHMACSHA384192, AES128CTSHMACSHA256128, ARCFOURHMAC}
+	if !reflect.DeepEqual(c.LibDefaults.PermittedEnctypes, permitted) {
+		t.Errorf("unexpected permitted_enctypes %v", c.LibDefaults.PermittedEnctypes)
+	}
+	if !reflect.DeepEqual(c.LibDefaults.DefaultTGSEnctypes, permitted) {
+		t.Errorf("expected default_tgs_enctypes to default to permitted_enctypes, but got %v", c.LibDefaults.DefaultTGSEnctypes)
+	}
+}
+
+func TestHostRealm(t *testing.T) {
+	c := load(t, "krb5.conf")
+
+	tests := []struct {
+		host   string
+		domain string
+		realm  string
+	}{
+		{host: "db.example.com", domain: "db.example.com", realm: "DB.EXAMPLE.COM"},
+		{host: "www.example.com", domain: ".example.com", realm: "EXAMPLE.COM"},
+		{host: "WWW.Example.COM.", domain: ".example.com", realm: "EXAMPLE.COM"},
+		// like the MIT library, an entry without a leading dot also maps
+		// the hosts below it.
+		{host: "a.b.db.example.com", domain: "db.example.com", realm: "DB.EXAMPLE.COM"},
+		{host: "app.corp.example.org", domain: ".corp.example.org", realm: "CORP.EXAMPLE.ORG"},
+		// nor is a domain mapped by its own leading dot entry.
+		{host: "example.com"},
+		{host: "corp.example.org"},
+		{host: "localhost"},
+		{host: ""},
+	}
+
+	for _, test := range tests {
+		domain, realm, ok := c.HostRealm(test.host)
+		if ok != (test.realm != "") || domain != test.domain || realm != test.realm {
+			t.Errorf("%q: expected %q, %q, but got %q, %q, %v", test.host, test.domain, test.realm, domain, realm, ok)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	c := load(t, "krb5.conf")
+
+	tests := []struct {
+		name      string
+		host      string
+		principal string
+		expected  Resolution
+		realms    []string
+	}{
+		{
+			name:      "same realm",
+			host:      "www.example.com",
+			principal: "user",
+			expected: Resolution{
+				HostRealm:          "EXAMPLE.COM",
+				HostRealmFrom:      "domain_realm .example.com",
+				PrincipalRealm:     "EXAMPLE.COM",
+				PrincipalRealmFrom: "default_realm",
+			},
+			realms: []string{"EXAMPLE.COM"},
+		},
+		{
+			name:      "capaths",
+			host:      "app.corp.example.org",
+			principal: "user@EXAMPLE.COM",
+			expected: Resolution{
+				HostRealm:          "CORP.EXAMPLE.ORG",
+				HostRealmFrom:      "domain_realm .corp.example.org",
+				PrincipalRealm:     "EXAMPLE.COM",
+				PrincipalRealmFrom: "named in the principal",
+				Path:               []string{"PARTNER.EXAMPLE.NET", "EXAMPLE.ORG"},
+				PathFrom:           "capaths",
+			},
+			realms: []string{"EXAMPLE.COM", "PARTNER.EXAMPLE.NET", "EXAMPLE.ORG", "CORP.EXAMPLE.ORG"},
+		},
+		{
+			name:      "direct capaths",
+			host:      "db.example.com",
+			principal: "user@EXAMPLE.COM",
+			expected: Resolution{
+				HostRealm:          "DB.EXAMPLE.COM",
+				HostRealmFrom:      "domain_realm db.example.com",
+				PrincipalRealm:     "EXAMPLE.COM",
+				PrincipalRealmFrom: "named in the principal",
+				Path:               []string{},
+				PathFrom:           "capaths",
+			},
+			realms: []string{"EXAMPLE.COM", "DB.EXAMPLE.COM"},
+		},
+		{
+			name:      "hierarchy",
+			host:      "crm.sales.west.example.com",
+			principal: "user@ENG.EAST.EXAMPLE.COM",
+			expected: Resolution{
+				HostRealm:          "SALES.WEST.EXAMPLE.COM",
+				HostRealmFrom:      "domain_realm .sales.west.example.com",
+				PrincipalRealm:     "ENG.EAST.EXAMPLE.COM",
+				PrincipalRealmFrom: "named in the principal",
+				Path:               []string{"EAST.EXAMPLE.COM", "EXAMPLE.COM", "WEST.EXAMPLE.COM"},
+				PathFrom:           "realm hierarchy",
+			},
+			realms: []string{"ENG.EAST.EXAMPLE.COM", "EAST.EXAMPLE.COM", "EXAMPLE.COM", "WEST.EXAMPLE.COM", "SALES.WEST.EXAMPLE.COM"},
+		},
+		{
+			name:      "parent realm",
+			host:      "www.example.com",
+			principal: "user@ENG.EAST.EXAMPLE.COM",
+			expected: Resolution{
+				HostRealm:          "EXAMPLE.COM",
+				HostRealmFrom:      "domain_realm .example.com",
+				PrincipalRealm:     "ENG.EAST.EXAMPLE.COM",
+				PrincipalRealmFrom: "named in the principal",
+				Path:               []string{"EAST.EXAMPLE.COM"},
+				PathFrom:           "realm hierarchy",
+			},
+			realms: []string{"ENG.EAST.EXAMPLE.COM", "EAST.EXAMPLE.COM", "EXAMPLE.COM"},
+		},
+		{
+			name:      "no common parent",
+			host:      "app.corp.example.org",
+			principal: "user@OTHER.NET",
+			expected: Resolution{
+				HostRealm:          "CORP.EXAMPLE.ORG",
+				HostRealmFrom:      "domain_realm .corp.example.org",
+				PrincipalRealm:     "OTHER.NET",
+				PrincipalRealmFrom: "named in the principal",
+				PathFrom:           "realm hierarchy",
+			},
+			realms: []string{"OTHER.NET", "CORP.EXAMPLE.ORG"},
+		},
+		{
+			name:      "referral",
+			host:      "unmapped.test",
+			principal: "user@EXAMPLE.COM",
+			expected: Resolution{
+				HostRealm:          "EXAMPLE.COM",
+				HostRealmFrom:      "no domain_realm mapping, referral from the principal realm",
+				PrincipalRealm:     "EXAMPLE.COM",
+				PrincipalRealmFrom: "named in the principal",
+			},
+			realms: []string{"EXAMPLE.COM"},
+		},
+	}
+
+	for _, test := range tests {
+		r := c.Resolve(test.host, test.principal)
+		test.expected.Host = test.host
+		test.expected.Principal = test.principal
+		if !reflect.DeepEqual(*r, test.expected) {
+			t.Errorf("%s: expected %+v, but got %+v", test.name, test.expected, *r)
+		}
+		if realms := r.Realms(); !reflect.DeepEqual(realms, test.realms) {
+			t.Errorf("%s: expected realms %v, but got %v", test.name, test.realms, realms)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	resolver := &fakeResolver{
+		hosts: map[string]bool{"kdc1.example.com": true, "2001:db8::1": true},
+		srv:   map[string]bool{"EXAMPLE.COM": true},
+	}
+
+	tests := []struct {
+		name     string
+		conf     string
+		target   Target
+		expected []string
+	}{
+		{
+			name:   "capaths without kdcs",
+			conf:   "krb5.conf",
+			target: Target{Host: "app.corp.example.org", Principal: "user@EXAMPLE.COM"},
+			expected: []string{
+				"testdata/base.conf:7: warning: permitted_enctypes contains the unknown enctype blowfish",
+				"testdata/krb5.conf:6: error: kdc kdc2.example.com of realm EXAMPLE.COM cannot be resolved: lookup kdc2.example.com: no such host",
+				"error: realm PARTNER.EXAMPLE.NET has no kdc in [realms] and dns_lookup_kdc is off",
+				"error: realm EXAMPLE.ORG has no kdc in [realms] and dns_lookup_kdc is off",
+				"testdata/base.conf:4: warning: rdns = true only applies when dns_canonicalize_hostname = fallback falls back to canonicalizing",
+			},
+		},
+		{
+			name:   "referral",
+			conf:   "rdns.conf",
+			target: Target{Host: "unmapped.test", Principal: "user"},
+			expected: []string{
+				"warning: no domain_realm mapping for unmapped.test, the service ticket is requested from EXAMPLE.COM and relies on a referral",
+				"testdata/rdns.conf:3: warning: rdns = yes has no effect because dns_canonicalize_hostname is false",
+			},
+		},
+		{
+			name:   "kdcs from the dns",
+			conf:   "dns.conf",
+			target: Target{Host: "db.example.net", Principal: "user@EXAMPLE.COM"},
+			expected: []string{
+				"error: realm EXAMPLE.NET has no kdc in [realms] and no _kerberos._udp.EXAMPLE.NET SRV record",
+			},
+		},
+		{
+			name:   "no realm",
+			conf:   "dns.conf",
+			target: Target{Host: "www.example.com", Principal: "user"},
+			expected: []string{
+				"error: principal user has no realm and there is no default_realm",
+			},
+		},
+		{
+			name:   "usable keytab",
+			conf:   "rdns.conf",
+			target: Target{Principal: "user", KeytabEnctypes: []Enctype{ARCFOURHMAC, AES128CTSHMACSHA196}},
+			expected: []string{
+				"testdata/rdns.conf:3: warning: rdns = yes has no effect because dns_canonicalize_hostname is false",
+			},
+		},
+		{
+			name:   "unusable keytab",
+			conf:   "krb5.conf",
+			target: Target{Principal: "user@DB.EXAMPLE.COM", KeytabEnctypes: []Enctype{ARCFOURHMAC, DES3CBCSHA1}},
+			expected: []string{
+				"testdata/base.conf:7: warning: permitted_enctypes contains the unknown enctype blowfish",
+				"testdata/base.conf:4: warning: rdns = true only applies when dns_canonicalize_hostname = fallback falls back to canonicalizing",
+				"testdata/base.conf:7: warning: des3-cbc-sha1 keys are not permitted by permitted_enctypes",
+				"testdata/base.conf:6: error: no keytab entry has a permitted default_tkt_enctypes enctype, the keytab has arcfour-hmac des3-cbc-sha1 but the configuration allows aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 aes256-cts-hmac-sha384-192 aes128-cts-hmac-sha256-128",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		c := load(t, test.conf)
+		c.Resolver = resolver
+
+		var problems []string
+		for _, p := range c.Check(test.target) {
+			problems = append(problems, filepath.ToSlash(p.String()))
+		}
+		if !reflect.DeepEqual(problems, test.expected) {
+			t.Errorf("%s: expected problems\n%s\nbut got\n%s", test.name, strings.Join(test.expected, "\n"), strings.Join(problems, "\n"))
+		}
+	}
+}
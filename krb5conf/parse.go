@@ -0,0 +1,260 @@
+package krb5conf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Pos is a position in a configuration file.
+type Pos struct {
+	File string
+	Line int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// Relation is a "tag = value" line, or a "tag = { ... }" subsection
+// when Sub is not nil.
+type Relation struct {
+	Tag   string
+	Value string
+	Sub   []*Relation
+	Pos   Pos
+}
+
+// Section is a [name] section of a configuration file.
+type Section struct {
+	Name      string
+	Relations []*Relation
+	Pos       Pos
+}
+
+// Profile is the parsed content of a configuration file and the files
+// it includes, in the order they were read.
+type Profile struct {
+	Files    []string
+	Sections []*Section
+}
+
+// Relations gets the relations of all the sections named name. A section
+// may appear several times, for instance once per included file.
+func (p *Profile) Relations(name string) []*Relation {
+	var rels []*Relation
+	for _, s := range p.Sections {
+		if s.Name == name {
+			rels = append(rels, s.Relations...)
+		}
+	}
+	return rels
+}
+
+// Find gets the first relation with the tag in the named section.
+func (p *Profile) Find(section, tag string) *Relation {
+	return find(p.Relations(section), tag)
+}
+
+func find(rels []*Relation, tag string) *Relation {
+	for _, r := range rels {
+		if r.Tag == tag {
+			return r
+		}
+	}
+	return nil
+}
+
+// maxIncludeDepth guards against files that include each other.
+const maxIncludeDepth = 16
+
+// includedirName matches the names of the files read from an includedir,
+// the same ones the MIT library reads.
+var includedirName = regexp.MustCompile(`^([A-Za-z0-9_-]+|.*\.conf)$`)
+
+func (p *Profile) parseFile(path string, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("%s: includes are nested more than %d deep", path, maxIncludeDepth)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return p.parse(f, path, depth)
+}
+
+func (p *Profile) parseDir(dir string, depth int) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		if info.IsDir() || !includedirName.MatchString(info.Name()) {
+			continue
+		}
+		if err := p.parseFile(filepath.Join(dir, info.Name()), depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parse parses a single file. Relative include paths are resolved
+// against the directory of the including file.
+func (p *Profile) parse(r io.Reader, name string, depth int) error {
+	p.Files = append(p.Files, name)
+
+	var section *Section
+	// open holds the relations whose subsections are not closed yet.
+	var open []*Relation
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		pos := Pos{File: name, Line: line}
+		text := strings.TrimSpace(scanner.Text())
+
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%s: %s", pos, fmt.Sprintf(format, args...))
+		}
+
+		switch {
+		case text == "" || text[0] == '#' || text[0] == ';':
+			continue
+
+		case strings.HasPrefix(text, "include ") || strings.HasPrefix(text, "includedir "):
+			fields := strings.SplitN(text, " ", 2)
+			path := strings.TrimSpace(fields[1])
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(name), path)
+			}
+
+			var err error
+			if fields[0] == "include" {
+				err = p.parseFile(path, depth+1)
+			} else {
+				err = p.parseDir(path, depth)
+			}
+			if err != nil {
+				return errorf("%v", err)
+			}
+
+			// an included file starts its own sections.
+			section = nil
+
+		case strings.HasPrefix(text, "module "):
+			// modules are shared libraries, which cannot be checked here.
+			continue
+
+		case text[0] == '[':
+			end := strings.Index(text, "]")
+			if end == -1 {
+				return errorf("missing ] in section header")
+			}
+			if len(open) > 0 {
+				return errorf("section %s starts before %s is closed", text[:end+1], open[len(open)-1].Tag)
+			}
+			section = &Section{Name: text[1:end], Pos: pos}
+			p.Sections = append(p.Sections, section)
+
+		case text[0] == '}':
+			if len(open) == 0 {
+				return errorf("unexpected }")
+			}
+			open = open[:len(open)-1]
+
+		default:
+			if section == nil {
+				return errorf("relation outside of a section")
+			}
+
+			eq := strings.Index(text, "=")
+			if eq == -1 {
+				return errorf("missing = after %s", text)
+			}
+
+			rel := &Relation{
+				Tag: strings.TrimSuffix(strings.TrimSpace(text[:eq]), "*"),
+				Pos: pos,
+			}
+			if rel.Tag == "" || strings.ContainsAny(rel.Tag, " \t") {
+				return errorf("invalid tag %q", strings.TrimSpace(text[:eq]))
+			}
+
+			value := strings.TrimSpace(text[eq+1:])
+			if strings.HasPrefix(value, "{") {
+				if strings.TrimSpace(value[1:]) != "" {
+					return errorf("unexpected text after {")
+				}
+				rel.Sub = []*Relation{}
+			} else {
+				var err error
+				rel.Value, err = unquote(value)
+				if err != nil {
+					return errorf("%v", err)
+				}
+			}
+
+			if len(open) > 0 {
+				parent := open[len(open)-1]
+				parent.Sub = append(parent.Sub, rel)
+			} else {
+				section.Relations = append(section.Relations, rel)
+			}
+			if rel.Sub != nil {
+				open = append(open, rel)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+
+	if len(open) > 0 {
+		rel := open[len(open)-1]
+		return fmt.Errorf("%s: %s is never closed", rel.Pos, rel.Tag)
+	}
+	return nil
+}
+
+// unquote removes the quotes and escapes of a quoted value and returns
+// other values unchanged.
+func unquote(value string) (string, error) {
+	if !strings.HasPrefix(value, `"`) {
+		return value, nil
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '"':
+			return b.String(), nil
+		case c == '\\' && i+1 < len(value):
+			i++
+			switch value[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'b':
+				b.WriteByte('\b')
+			default:
+				b.WriteByte(value[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated quoted value")
+}
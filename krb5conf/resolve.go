@@ -0,0 +1,123 @@
+package krb5conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Resolution is what the configuration decides for a client principal
+// authenticating to a service on a host.
+type Resolution struct {
+	Host      string
+	HostRealm string
+	// HostRealmFrom explains how the host realm was found.
+	HostRealmFrom string
+
+	Principal      string
+	PrincipalRealm string
+	// PrincipalRealmFrom explains how the principal realm was found.
+	PrincipalRealmFrom string
+
+	// Path are the realms between the principal realm and the host
+	// realm, which is empty when no other realm is involved.
+	Path []string
+	// PathFrom explains how the path was found.
+	PathFrom string
+}
+
+// Realms gets the realms whose KDCs the client talks to.
+func (r *Resolution) Realms() []string {
+	var realms []string
+	for _, realm := range append(append([]string{r.PrincipalRealm}, r.Path...), r.HostRealm) {
+		if realm != "" && (len(realms) == 0 || realms[len(realms)-1] != realm) {
+			realms = append(realms, realm)
+		}
+	}
+	return realms
+}
+
+// Resolve finds the realms for a host and a principal and the path
+// between them.
+func (c *Config) Resolve(host, principal string) *Resolution {
+	r := &Resolution{Host: host, Principal: principal}
+
+	if i := strings.LastIndex(principal, "@"); i != -1 {
+		r.PrincipalRealm = principal[i+1:]
+		r.PrincipalRealmFrom = "named in the principal"
+	} else if c.LibDefaults.DefaultRealm != "" {
+		r.PrincipalRealm = c.LibDefaults.DefaultRealm
+		r.PrincipalRealmFrom = "default_realm"
+	}
+
+	if domain, realm, ok := c.HostRealm(host); ok {
+		r.HostRealm = realm
+		r.HostRealmFrom = fmt.Sprintf("domain_realm %s", domain)
+	} else {
+		// without a mapping the library asks the principal's realm and
+		// follows referrals.
+		r.HostRealm = r.PrincipalRealm
+		r.HostRealmFrom = "no domain_realm mapping, referral from the principal realm"
+	}
+
+	if r.PrincipalRealm != "" && r.HostRealm != "" && r.PrincipalRealm != r.HostRealm {
+		if path, ok := c.CAPaths[r.PrincipalRealm][r.HostRealm]; ok {
+			r.Path = path
+			r.PathFrom = "capaths"
+		} else {
+			r.Path = hierarchicalPath(r.PrincipalRealm, r.HostRealm)
+			r.PathFrom = "realm hierarchy"
+		}
+	}
+
+	return r
+}
+
+// HostRealm finds the domain_realm mapping for a host. Like the MIT
+// library, it tries the host itself and then each of its parent
+// domains, with and without the leading dot.
+func (c *Config) HostRealm(host string) (domain, realm string, ok bool) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	candidate := host
+	for candidate != "" {
+		if realm, ok := c.DomainRealm[candidate]; ok {
+			return candidate, realm, true
+		}
+
+		if candidate[0] == '.' {
+			candidate = candidate[1:]
+		} else if i := strings.Index(candidate, "."); i != -1 {
+			candidate = candidate[i:]
+		} else {
+			candidate = ""
+		}
+	}
+	return "", "", false
+}
+
+// hierarchicalPath gets the realms between client and server when
+// walking up to their common parent and back down.
+func hierarchicalPath(client, server string) []string {
+	c := strings.Split(client, ".")
+	s := strings.Split(server, ".")
+
+	common := 0
+	for common < len(c) && common < len(s) && c[len(c)-1-common] == s[len(s)-1-common] {
+		common++
+	}
+	if common == 0 {
+		return nil
+	}
+
+	var path []string
+	for i := 1; i < len(c)-common; i++ {
+		path = append(path, strings.Join(c[i:], "."))
+	}
+	if len(c) > common && len(s) > common {
+		path = append(path, strings.Join(c[len(c)-common:], "."))
+	}
+	for i := len(s) - common - 1; i > 0; i-- {
+		path = append(path, strings.Join(s[i:], "."))
+	}
+	return path
+}
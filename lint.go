@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/10gen/mongo-go-driver/mongo/connstring"
+)
+
+func runLintURI(args []string) error {
+	fs := flag.NewFlagSet("lint-uri", flag.ExitOnError)
+	uri := fs.String("uri", "mongodb://ldaptest.10gen.cc:27017", "mongodb uri to check")
+	_ = fs.Parse(args)
+
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		*uri = fs.Arg(0)
+	default:
+		return fmt.Errorf("usage: kerb-debug lint-uri [uri]")
+	}
+
+	cs, err := connstring.Parse(*uri)
+	if err != nil {
+		return err
+	}
+
+	warnings := cs.Warnings()
+	for _, w := range warnings {
+		fmt.Println(w)
+	}
+
+	if len(warnings) > 0 {
+		return fmt.Errorf("%d warnings", len(warnings))
+	}
+
+	fmt.Println("no warnings")
+	return nil
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/10gen/mongo-go-driver/mongo/connstring"
+	"github.com/10gen/mongo-go-driver/mongo/model"
+	"github.com/10gen/mongo-go-driver/mongo/private/auth"
+	"github.com/10gen/mongo-go-driver/mongo/private/conn"
+)
+
+func runLoad(args []string) error {
+	fs := flag.NewFlagSet("load", flag.ExitOnError)
+	uri := fs.String("uri", "mongodb://ldaptest.10gen.cc:27017", "mongodb uri of the server to load, only the first host is used")
+	username := fs.String("username", "drivers@LDAPTEST.10GEN.CC", "principal to authenticate as")
+	passwordFrom := fs.String("password-from", "prompt", "where to get the principal's password: "+passwordSources)
+	keytab := fs.String("keytab", "", "keytab to renew expired kerberos credentials from")
+	ccache := fs.String("ccache", "", "credential cache to share kerberos credentials between connections, otherwise every connection does an AS exchange")
+	authzid := fs.String("authzid", "", "user to act as instead of the kerberos principal")
+	mechanism := fs.String("mechanism", auth.GSSAPI, "authentication mechanism to use")
+	concurrency := fs.Int("concurrency", 10, "number of connections to authenticate at once")
+	duration := fs.Duration("duration", 30*time.Second, "how long to generate load for, no limit when -count is given without it")
+	count := fs.Int("count", 0, "stop after this many attempts, 0 for no limit")
+	timeout := fs.Duration("timeout", 10*time.Second, "maximum time for a single attempt")
+	proxy := fs.String("proxy", "", proxyUsage)
+	sshBastion := fs.String("ssh-bastion", "", sshBastionUsage)
+	sshKey := fs.String("ssh-key", "", sshKeyUsage)
+	sshKnownHosts := fs.String("ssh-known-hosts", "", sshKnownHostsUsage)
+	_ = fs.Parse(args)
+
+	if *concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+
+	cs, err := connstring.Parse(*uri)
+	if err != nil {
+		return err
+	}
+	if err = validateConnString(cs); err != nil {
+		return err
+	}
+	addr := model.Addr(cs.Hosts[0])
+	if err = checkSSHBastion(*sshBastion, *proxy, cs); err != nil {
+		return err
+	}
+	connOpts, err := proxyOptions(*proxy, cs)
+	if err != nil {
+		return err
+	}
+	if *sshBastion != "" {
+		sshOpts, closeTunnel, err := sshOptions(*sshBastion, *sshKey, *sshKnownHosts)
+		if err != nil {
+			return err
+		}
+		defer closeTunnel()
+		connOpts = sshOpts
+	}
+
+	password, err := passwordProvider(*passwordFrom)
+	if err != nil {
+		return err
+	}
+	// ask for the password once up front, rather than from every worker.
+	if _, err = password.Password(context.Background()); err != nil {
+		return err
+	}
+
+	cred := &auth.Cred{
+		Source:           "$external",
+		Username:         *username,
+		PasswordSet:      true,
+		PasswordProvider: password,
+		Props:            mechanismProperties(*keytab, *ccache, *authzid),
+	}
+	switch *mechanism {
+	case auth.GSSAPI, auth.PLAIN:
+	default:
+		cred.Source = "admin"
+	}
+
+	var renewals, failedRenewals int64
+	cred.RenewalListener = func(e *auth.RenewalEvent) {
+		atomic.AddInt64(&renewals, 1)
+		if e.Err != nil {
+			atomic.AddInt64(&failedRenewals, 1)
+		}
+	}
+
+	authenticator, err := auth.CreateAuthenticator(*mechanism, cred)
+	if err != nil {
+		return err
+	}
+
+	// a run of a given number of attempts is only limited in time when
+	// asked to be.
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if *count == 0 || flagSet(fs, "duration") {
+		ctx, cancel = context.WithTimeout(context.Background(), *duration)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+	end, limited := ctx.Deadline()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	fmt.Printf("authenticating against %s with %d concurrent connections...\n", addr, *concurrency)
+
+	remaining := int64(*count)
+
+	results := make(chan *loadAttempt, *concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if *count > 0 && atomic.AddInt64(&remaining, -1) < 0 {
+					return
+				}
+				attempt := authenticateOnce(ctx, authenticator, addr, *timeout, connOpts)
+				if attempt.err != nil && (ctx.Err() != nil || (limited && !time.Now().Before(end))) {
+					// interrupted by the end of the run, not a failure.
+					return
+				}
+				results <- attempt
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	report := newLoadReport()
+	for attempt := range results {
+		report.add(attempt)
+	}
+
+	report.print()
+	if renewals > 0 {
+		fmt.Printf("\ncredential renewals: %d (%d failed)\n", renewals, failedRenewals)
+	}
+	return nil
+}
+
+// flagSet tells whether the flag was given on the command line.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// loadPhase is the part of an attempt that took the time or failed.
+type loadPhase int
+
+const (
+	dialPhase loadPhase = iota
+	handshakePhase
+	saslPhase
+)
+
+var loadPhases = []loadPhase{dialPhase, handshakePhase, saslPhase}
+
+func (p loadPhase) String() string {
+	switch p {
+	case dialPhase:
+		return "dial"
+	case handshakePhase:
+		return "handshake"
+	case saslPhase:
+		return "sasl"
+	}
+	return "unknown"
+}
+
+type loadAttempt struct {
+	durations [3]time.Duration
+	failed    loadPhase
+	err       error
+}
+
+// authenticateOnce opens and authenticates a single connection without a
+// pool, timing the dial, the isMaster handshake and the SASL conversation.
+func authenticateOnce(ctx context.Context, authenticator auth.Authenticator, addr model.Addr, timeout time.Duration, connOpts []conn.Option) *loadAttempt {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialed, opened time.Time
+	a := &loadAttempt{failed: dialPhase}
+	timedDialer := func(dialer conn.Dialer) conn.Dialer {
+		return func(ctx context.Context, d *net.Dialer, network, address string) (net.Conn, error) {
+			nc, err := dialer(ctx, d, network, address)
+			if err == nil {
+				dialed = time.Now()
+				a.failed = handshakePhase
+			}
+			return nc, err
+		}
+	}
+	opener := func(ctx context.Context, addr model.Addr, opts ...conn.Option) (conn.Connection, error) {
+		c, err := conn.New(ctx, addr, opts...)
+		if err == nil {
+			opened = time.Now()
+			a.failed = saslPhase
+		}
+		return c, err
+	}
+
+	started := time.Now()
+	c, err := auth.NewConnection(
+		ctx,
+		authenticator,
+		opener,
+		addr,
+		// the proxy dialer must be set before it is wrapped.
+		append(
+			append([]conn.Option{}, connOpts...),
+			conn.WithAppName("kerb-load"),
+			conn.WithWrappedDialer(timedDialer),
+		)...,
+	)
+	if err != nil {
+		a.err = err
+		return a
+	}
+	finished := time.Now()
+	_ = c.Close()
+
+	a.durations[dialPhase] = dialed.Sub(started)
+	a.durations[handshakePhase] = opened.Sub(dialed)
+	a.durations[saslPhase] = finished.Sub(opened)
+	return a
+}
+
+// kdcFailures are fragments of the Kerberos library messages which mean
+// the KDC could not be reached or refused to issue a ticket.
+var kdcFailures = []string{
+	"Cannot contact any KDC",
+	"Cannot find KDC",
+	"KDC has no support",
+	"KDC reply did not match",
+	"not found in Kerberos database",
+	"Clock skew too great",
+	"Cannot resolve network address for KDC",
+}
+
+// classifyLoadError groups an error with others that have the same cause.
+func classifyLoadError(a *loadAttempt) string {
+	msg := a.err.Error()
+
+	if ne, ok := a.err.(net.Error); ok && ne.Timeout() || strings.Contains(msg, context.DeadlineExceeded.Error()) {
+		return fmt.Sprintf("%s timeout", a.failed)
+	}
+
+	if a.failed != saslPhase {
+		return fmt.Sprintf("%s error", a.failed)
+	}
+
+	if _, ok := auth.FindAuthzidError(a.err); ok {
+		return "authzid rejected"
+	}
+
+	if name, _, ok := auth.GSSAPICondition(a.err); ok {
+		return name
+	}
+
+	for _, fragment := range kdcFailures {
+		if strings.Contains(msg, fragment) {
+			return "kdc failure"
+		}
+	}
+
+	if _, ok := a.err.(*auth.Error); ok {
+		return "authentication failure"
+	}
+	return "sasl error"
+}
+
+type loadErrors struct {
+	count   int
+	example string
+	// remediation tells how to fix GSSAPI errors with a known cause.
+	remediation string
+}
+
+type loadReport struct {
+	started   time.Time
+	attempts  int
+	durations [3][]time.Duration
+	totals    []time.Duration
+	errors    map[string]*loadErrors
+}
+
+func newLoadReport() *loadReport {
+	return &loadReport{
+		started: time.Now(),
+		errors:  make(map[string]*loadErrors),
+	}
+}
+
+func (r *loadReport) add(a *loadAttempt) {
+	r.attempts++
+
+	if a.err != nil {
+		class := classifyLoadError(a)
+		e, ok := r.errors[class]
+		if !ok {
+			e = &loadErrors{example: a.err.Error()}
+			_, e.remediation, _ = auth.GSSAPICondition(a.err)
+			r.errors[class] = e
+		}
+		e.count++
+		return
+	}
+
+	var total time.Duration
+	for _, phase := range loadPhases {
+		r.durations[phase] = append(r.durations[phase], a.durations[phase])
+		total += a.durations[phase]
+	}
+	r.totals = append(r.totals, total)
+}
+
+func (r *loadReport) print() {
+	elapsed := time.Since(r.started)
+	succeeded := len(r.totals)
+
+	fmt.Println()
+	fmt.Printf("attempts:   %d in %s\n", r.attempts, elapsed.Round(time.Millisecond))
+	fmt.Printf("succeeded:  %d (%.1f/s)\n", succeeded, float64(succeeded)/elapsed.Seconds())
+	fmt.Printf("failed:     %d (%.2f%%)\n", r.attempts-succeeded, percentOf(r.attempts-succeeded, r.attempts))
+
+	if succeeded > 0 {
+		fmt.Println()
+		fmt.Printf("%-10s %10s %10s %10s %10s\n", "phase", "p50", "p90", "p99", "max")
+		for _, phase := range loadPhases {
+			printPercentiles(phase.String(), r.durations[phase])
+		}
+		printPercentiles("total", r.totals)
+	}
+
+	if len(r.errors) > 0 {
+		var classes []string
+		for class := range r.errors {
+			classes = append(classes, class)
+		}
+		sort.Slice(classes, func(i, j int) bool {
+			return r.errors[classes[i]].count > r.errors[classes[j]].count
+		})
+
+		fmt.Println()
+		fmt.Println("errors:")
+		for _, class := range classes {
+			e := r.errors[class]
+			fmt.Printf("  %-24s %6d (%.2f%%)\n", class, e.count, percentOf(e.count, r.attempts))
+			fmt.Printf("    e.g. %s\n", e.example)
+			if e.remediation != "" {
+				fmt.Printf("    fix: %s\n", e.remediation)
+			}
+		}
+	}
+}
+
+func printPercentiles(name string, durations []time.Duration) {
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	at := func(p float64) time.Duration {
+		return durations[int(p*float64(len(durations)-1))].Round(10 * time.Microsecond)
+	}
+	fmt.Printf("%-10s %10s %10s %10s %10s\n", name, at(0.5), at(0.9), at(0.99), at(1))
+}
+
+func percentOf(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
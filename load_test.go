@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"testing"
+	"time"
+)
+
+func TestFlagSet(t *testing.T) {
+	tests := []struct {
+		args []string
+		set  bool
+	}{
+		{args: nil},
+		{args: []string{"-count", "10"}},
+		{args: []string{"-count", "10", "-duration", "1m"}, set: true},
+		// the default value given explicitly is still given.
+		{args: []string{"-duration", "30s"}, set: true},
+	}
+
+	for _, test := range tests {
+		fs := flag.NewFlagSet("load", flag.ContinueOnError)
+		fs.Int("count", 0, "")
+		fs.Duration("duration", 30*time.Second, "")
+		if err := fs.Parse(test.args); err != nil {
+			t.Fatal(err)
+		}
+		if set := flagSet(fs, "duration"); set != test.set {
+			t.Errorf("%v: expected %v, but got %v", test.args, test.set, set)
+		}
+	}
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/10gen/mongo-go-driver/bson"
@@ -11,30 +14,161 @@ import (
 	"github.com/10gen/mongo-go-driver/mongo/private/auth"
 	"github.com/10gen/mongo-go-driver/mongo/private/cluster"
 	"github.com/10gen/mongo-go-driver/mongo/private/conn"
+	"github.com/10gen/mongo-go-driver/mongo/private/msg"
 	"github.com/10gen/mongo-go-driver/mongo/private/ops"
 	"github.com/10gen/mongo-go-driver/mongo/private/server"
 	"github.com/10gen/mongo-go-driver/mongo/readpref"
+	"github.com/rychipman/kerb-debug/capture"
 )
 
 func main() {
-	uri := "mongodb://ldaptest.10gen.cc:27017"
-	username := "drivers@LDAPTEST.10GEN.CC"
-	password := "powerbook17"
+	name := "test"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
 
-	fmt.Println()
-	err := testKerb(uri, username, password)
+	var err error
+	switch name {
+	case "test":
+		err = runTest(args)
+	case "replay":
+		err = runReplay(args)
+	case "lint-uri":
+		err = runLintURI(args)
+	case "watch":
+		err = runWatch(args)
+	case "load":
+		err = runLoad(args)
+	case "kinit":
+		err = runKinit(args)
+	case "krb5conf":
+		err = runKrb5Conf(args)
+	case "keytab":
+		err = runKeytab(args)
+	default:
+		err = fmt.Errorf("unknown command %q", name)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+func runTest(args []string) error {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	uri := fs.String("uri", "mongodb://ldaptest.10gen.cc:27017", "mongodb uri of the server to test against")
+	username := fs.String("username", "drivers@LDAPTEST.10GEN.CC", "kerberos principal to authenticate as")
+	passwordFrom := fs.String("password-from", "prompt", "where to get the principal's password: "+passwordSources)
+	record := fs.String("record", "", "write a capture of all wire traffic to this file")
+	heartbeats := fs.Bool("heartbeats", false, "print every heartbeat attempt as it happens")
+	keytab := fs.String("keytab", "", "keytab to renew expired kerberos credentials from")
+	ccache := fs.String("ccache", "", "credential cache to reuse and store acquired kerberos credentials in, e.g. FILE:/tmp/krb5cc_test or MEMORY:test")
+	authzid := fs.String("authzid", "", "user to act as instead of the kerberos principal, which the server must map the principal to")
+	proxy := fs.String("proxy", "", proxyUsage)
+	sshBastion := fs.String("ssh-bastion", "", sshBastionUsage)
+	sshKey := fs.String("ssh-key", "", sshKeyUsage)
+	sshKnownHosts := fs.String("ssh-known-hosts", "", sshKnownHostsUsage)
+	mechanism := fs.String("mechanism", auth.GSSAPI, "mechanism to authenticate with, "+auth.GSSAPI+" or "+auth.PLAIN+" for an LDAP user, or both to compare them")
+	destroyCCache := fs.Bool("destroy-ccache", false, "destroy the -ccache credential cache when the test is done")
+	_ = fs.Parse(args)
+
+	mechanisms, err := testMechanisms(*mechanism)
+	if err != nil {
+		return err
+	}
+
+	password, err := passwordProvider(*passwordFrom)
 	if err != nil {
-		fmt.Printf("kerb test failed: %v\n", err)
+		return err
+	}
+
+	if *ccache != "" && *destroyCCache {
+		defer func() {
+			if err := auth.DestroyCredentialCache(*ccache); err != nil {
+				fmt.Printf("unable to destroy credential cache: %v\n", err)
+			}
+		}()
+	}
+
+	cs, err := connstring.Parse(*uri)
+	if err != nil {
+		return err
+	}
+	if err = checkSSHBastion(*sshBastion, *proxy, cs); err != nil {
+		return err
+	}
+	// a proxy in the uri is applied along with the rest of it, and the
+	// flags' options after it.
+	connOpts, err := proxyOptions(*proxy, connstring.ConnString{})
+	if err != nil {
+		return err
+	}
+	if *sshBastion != "" {
+		sshOpts, closeTunnel, err := sshOptions(*sshBastion, *sshKey, *sshKnownHosts)
+		if err != nil {
+			return err
+		}
+		defer closeTunnel()
+		connOpts = sshOpts
+	}
+	var serverOpts []server.Option
+	if *record != "" {
+		f, err := os.Create(*record)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		codec := capture.NewRecordingCodec(msg.NewWireProtocolCodec(), f)
+		defer func() {
+			if err := codec.Err(); err != nil {
+				fmt.Printf("capture is incomplete: %v\n", err)
+			}
+		}()
+		connOpts = append(connOpts, conn.WithCodec(codec))
+	}
+
+	if *heartbeats {
+		serverOpts = append(serverOpts, server.WithHeartbeatListener(printHeartbeatEvent))
+	}
+	serverOpts = append(serverOpts, server.WithMoreConnectionOptions(connOpts...))
+
+	var results []*authResult
+	for _, mech := range mechanisms {
+		fmt.Println()
+		result := testAuth(*uri, mech, *username, password, mechanismProperties(*keytab, *ccache, *authzid), serverOpts...)
+		if result.err != nil {
+			fmt.Printf("%s test failed: %v\n", mech, result.err)
+			printRemediation(result.err)
+		}
+		results = append(results, result)
+	}
+	if len(results) > 1 {
+		fmt.Println()
+		printComparison(*username, results)
 	}
 
 	fmt.Println()
-	err = driverTestKerb(uri, username, password)
+	err = driverTestKerb(*uri, serverOpts...)
 	if err != nil {
 		fmt.Printf("driver's kerb test failed: %v\n", err)
+		printRemediation(err)
 	}
+
+	return nil
 }
 
-func testKerb(uri, username, password string) error {
+// testAuth authenticates a single connection, printing each step, and
+// reports which users and roles the server mapped the username to.
+func testAuth(uri, mechanism, username string, password auth.CredentialProvider, props map[string]string, serverOpts ...server.Option) *authResult {
+	result := &authResult{mechanism: mechanism}
+	result.err = testAuthConn(result, uri, username, password, props, serverOpts...)
+	return result
+}
+
+func testAuthConn(result *authResult, uri, username string, password auth.CredentialProvider, props map[string]string, serverOpts ...server.Option) error {
 
 	cs, err := connstring.Parse(uri)
 	if err != nil {
@@ -50,7 +184,7 @@ func testKerb(uri, username, password string) error {
 		return err
 	}
 
-	clusterOpts := []cluster.Option{
+	clusterOpts := append([]cluster.Option{
 		// before WithConnString makes these
 		// the defaults...
 		cluster.WithServerOptions(
@@ -62,8 +196,7 @@ func testKerb(uri, username, password string) error {
 				conn.WithIdleTimeout(0),
 			),
 		),
-		cluster.WithConnString(cs),
-	}
+	}, connStringOptions(cs, serverOpts...)...)
 
 	c, err := cluster.New(clusterOpts...)
 	if err != nil {
@@ -78,6 +211,7 @@ func testKerb(uri, username, password string) error {
 	selector := readpref.Selector(rp)
 	server, err := c.SelectServer(ctx, selector, rp)
 	if err != nil {
+		printExplanation(explainSelection(c, err, readpref.ExplainingSelector(rp)))
 		return err
 	}
 
@@ -94,25 +228,47 @@ func testKerb(uri, username, password string) error {
 		fmt.Println("got non-nil conn")
 	}
 
+	if compressor := conn.Model().Compressor; compressor != "" {
+		fmt.Printf("negotiated %s compression\n", compressor)
+	}
+
 	authCred := &auth.Cred{
-		Source:      "$external",
-		Username:    username,
-		Password:    password,
-		PasswordSet: true,
+		Source:           "$external",
+		Username:         username,
+		PasswordSet:      true,
+		PasswordProvider: password,
+		Props:            props,
+		RenewalListener:  printRenewalEvent,
+
+		SecurityLayerListener: printSecurityLayerEvent,
 	}
 
-	authenticator, err := auth.CreateAuthenticator("GSSAPI", authCred)
+	authenticator, err := auth.CreateAuthenticator(result.mechanism, authCred)
 	if err != nil {
 		return err
 	}
 
+	if result.mechanism == auth.PLAIN {
+		fmt.Printf("warning: PLAIN is not protected by TLS, the password of %s is sent to %s in the clear\n", username, conn.Model().Addr)
+	}
+
+	started := time.Now()
 	err = authenticator.Auth(ctx, conn)
+	result.duration = time.Since(started)
 	if err != nil {
 		return err
 	}
 
 	fmt.Println("successfully authed connection")
 
+	status, err := getConnectionStatus(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("failed running connectionStatus: %v", err)
+	}
+	result.users = status.users()
+	result.roles = status.roles()
+	fmt.Printf("authenticated as %s with roles %s\n", listOrNone(result.users), listOrNone(result.roles))
+
 	return nil
 }
 
@@ -148,27 +304,52 @@ func getReadPreference(cs connstring.ConnString) (*readpref.ReadPref, error) {
 	return readpref.New(mode)
 }
 
-func driverTestKerb(uri, username, password string) error {
+// connStringOptions configures a cluster with the connection string and
+// then the server options of the flags, so that a flag such as -proxy
+// overrides the same setting in the uri.
+func connStringOptions(cs connstring.ConnString, serverOpts ...server.Option) []cluster.Option {
+	return []cluster.Option{
+		cluster.WithConnString(cs),
+		cluster.WithMoreServerOptions(serverOpts...),
+	}
+}
+
+func driverTestKerb(uri string, serverOpts ...server.Option) error {
 
 	cs, err := connstring.Parse(uri)
 	if err != nil {
 		return err
 	}
 
-	c, err := cluster.New(
-		cluster.WithConnString(cs),
+	clusterOpts := append(
+		connStringOptions(cs, serverOpts...),
+		cluster.WithRenewalListener(printRenewalEvent),
+		cluster.WithSecurityLayerListener(printSecurityLayerEvent),
 	)
+
+	monitor, err := cluster.StartMonitor(clusterOpts...)
 	if err != nil {
 		return err
 	}
+	defer monitor.Stop()
 
-	ctx := context.Background()
-	timeoutCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
+	c, err := cluster.NewWithMonitor(monitor, clusterOpts...)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
 
-	s, err := c.SelectServer(timeoutCtx, cluster.WriteSelector(), readpref.Primary())
+	ctx := context.Background()
+	s, err := c.SelectServer(ctx, cluster.WriteSelector(), readpref.Primary())
 	if err != nil {
-		return fmt.Errorf("%v: %v", err, c.Model().Servers[0].LastError)
+		exp := explainSelection(c, err, cluster.ExplainingWriteSelector())
+		printExplanation(exp)
+		for _, desc := range exp.Cluster.Servers {
+			if sm, ok := monitor.ServerMonitor(desc.Addr); ok {
+				printHeartbeats(sm.Heartbeats())
+			}
+		}
+		return err
 	}
 
 	dbname := cs.Database
@@ -184,7 +365,7 @@ func driverTestKerb(uri, username, password string) error {
 			ReadPref: readpref.Primary(),
 		},
 		dbname,
-		bson.D{{"count", "test"}},
+		bson.D{{Name: "count", Value: "test"}},
 		&result)
 	if err != nil {
 		return fmt.Errorf("failed executing count command on %s.%s: %v", dbname, "test", err)
@@ -192,5 +373,113 @@ func driverTestKerb(uri, username, password string) error {
 
 	fmt.Println(result)
 
+	if srv, ok := s.Server.(*server.Server); ok {
+		printPoolStats(srv.PoolStats())
+		printHeartbeats(srv.Heartbeats())
+	}
+
 	return nil
 }
+
+func printPoolStats(stats conn.PoolStats) {
+	fmt.Printf("pool: %d open (%d idle, %d in use), %d waiting, %d created, %d closed\n",
+		stats.Open, stats.Idle, stats.InUse, stats.Waiters, stats.TotalCreated, stats.TotalClosed)
+
+	if stats.WaitTime.Total() == 0 {
+		return
+	}
+	fmt.Print("pool wait times:")
+	for i, count := range stats.WaitTime.Counts {
+		if i < len(conn.WaitTimeBounds) {
+			fmt.Printf(" <%s: %d", conn.WaitTimeBounds[i], count)
+		} else {
+			fmt.Printf(" >=%s: %d", conn.WaitTimeBounds[i-1], count)
+		}
+	}
+	fmt.Println()
+}
+
+func printRenewalEvent(e *auth.RenewalEvent) {
+	reason := fmt.Sprintf("expiring in %s", e.Remaining)
+	if e.Reason != nil {
+		reason = fmt.Sprintf("after %v", e.Reason)
+	}
+
+	if e.Err != nil {
+		fmt.Printf("failed to renew credentials of %s from %s (%s): %v\n", e.Username, e.Source, reason, e.Err)
+		printRemediation(e.Err)
+		return
+	}
+	fmt.Printf("renewed credentials of %s from %s (%s), valid for %s\n", e.Username, e.Source, reason, e.Lifetime)
+}
+
+func printSecurityLayerEvent(e *auth.SecurityLayerEvent) {
+	offered := strings.Join(e.Offered, ", ")
+	if e.Chosen == "" {
+		fmt.Printf("%s offered security layers %s (max buffer %d), none acceptable: %v\n", e.Addr, offered, e.MaxBufferSize, e.Err)
+		return
+	}
+	fmt.Printf("%s offered security layers %s (max buffer %d), chose %s\n", e.Addr, offered, e.MaxBufferSize, e.Chosen)
+}
+
+// printRemediation explains how to fix err when it is a GSSAPI error
+// with a known cause or a rejected authorization identity.
+func printRemediation(err error) {
+	if authzErr, ok := auth.FindAuthzidError(err); ok {
+		fmt.Printf("  cause: %s authenticated, but may not act as %s\n", authzErr.Username, authzErr.Authzid)
+		fmt.Printf("  fix:   check that the server maps the principal to the user, or leave out the authzid to act as the principal\n")
+		return
+	}
+	if name, remediation, ok := auth.GSSAPICondition(err); ok {
+		fmt.Printf("  cause: %s\n  fix:   %s\n", name, remediation)
+	}
+}
+
+// explainSelection explains why SelectServer failed with the error,
+// against the description of the cluster selection failed on when there
+// is one.
+func explainSelection(c *cluster.Cluster, err error, selector cluster.ExplainingSelector) *cluster.Explanation {
+	if sse, ok := err.(*cluster.ServerSelectionError); ok {
+		return sse.Explain(selector)
+	}
+	return c.Explain(selector)
+}
+
+func printExplanation(exp *cluster.Explanation) {
+	fmt.Printf("server selection against %s cluster of %d servers selected %d\n",
+		exp.Cluster.Kind, len(exp.Cluster.Servers), len(exp.Selected))
+	for _, s := range exp.Selected {
+		fmt.Printf("  %s (%s): selected\n", s.Addr, s.Kind)
+	}
+	for _, elim := range exp.Eliminated {
+		fmt.Printf("  %s (%s): eliminated by %s: %s\n", elim.Server.Addr, elim.Server.Kind, elim.Stage, elim.Reason)
+	}
+	if exp.Err != nil {
+		fmt.Printf("  selector failed: %v\n", exp.Err)
+	}
+}
+
+func printHeartbeats(heartbeats []server.Heartbeat) {
+	for _, hb := range heartbeats {
+		fmt.Printf("heartbeat %s: %s\n", hb.Addr, describeHeartbeat(hb))
+	}
+}
+
+func printHeartbeatEvent(e *server.HeartbeatEvent) {
+	if e.Kind == server.HeartbeatStarted {
+		fmt.Printf("heartbeat %s: attempt %d started\n", e.Heartbeat.Addr, e.Heartbeat.Attempt)
+		return
+	}
+	fmt.Printf("heartbeat %s: %s\n", e.Heartbeat.Addr, describeHeartbeat(e.Heartbeat))
+}
+
+func describeHeartbeat(hb server.Heartbeat) string {
+	s := fmt.Sprintf("%s attempt %d took %s", hb.Started.Format("15:04:05.000"), hb.Attempt, hb.Duration)
+	if hb.NewConnection {
+		s += " (new connection)"
+	}
+	if hb.Err != nil {
+		return s + fmt.Sprintf(", failed: %v", hb.Err)
+	}
+	return s + fmt.Sprintf(", rtt %s", hb.RTT)
+}
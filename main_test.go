@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/10gen/mongo-go-driver/mongo/connstring"
+	"github.com/10gen/mongo-go-driver/mongo/private/cluster"
+	"github.com/10gen/mongo-go-driver/mongo/private/conn"
+	"github.com/10gen/mongo-go-driver/mongo/private/server"
+)
+
+func TestConnStringOptions_flags_override_the_uri(t *testing.T) {
+	// the proxy of the uri does not listen, so only the dialer of the
+	// flags can reach the server.
+	cs, err := connstring.Parse("mongodb://localhost:27017/?proxyHost=127.0.0.1&proxyPort=1&connect=direct")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dialed := make(chan string, 1)
+	flagDialer := func(ctx context.Context, d *net.Dialer, network, address string) (net.Conn, error) {
+		select {
+		case dialed <- address:
+		default:
+		}
+		return nil, errors.New("not dialing in a test")
+	}
+
+	c, err := cluster.New(connStringOptions(cs, server.WithMoreConnectionOptions(conn.WithDialer(flagDialer)))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	select {
+	case address := <-dialed:
+		if address != "localhost:27017" {
+			t.Errorf("expected the server to be dialed, but %s was", address)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the dialer of the flags was not used")
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/10gen/mongo-go-driver/mongo/connstring"
+	"github.com/10gen/mongo-go-driver/mongo/private/conn"
+)
+
+const proxyUsage = "SOCKS5 proxy to reach the servers through, as [user:password@]host[:port], instead of the proxyHost of the uri; the servers' own names are still used for kerberos"
+
+// proxyOptions creates the connection options for dialing through the
+// SOCKS5 proxy of the -proxy flag, or the one of the connection string
+// when the flag is empty.
+func proxyOptions(proxy string, cs connstring.ConnString) ([]conn.Option, error) {
+	if proxy == "" {
+		if cs.ProxyHost == "" {
+			return nil, nil
+		}
+		address := net.JoinHostPort(cs.ProxyHost, strconv.Itoa(int(cs.ProxyPort)))
+		return []conn.Option{conn.WithDialer(conn.SOCKS5Dialer(address, cs.ProxyUsername, cs.ProxyPassword))}, nil
+	}
+
+	u, err := url.Parse("socks5://" + proxy)
+	if err != nil || u.Host == "" || u.Path != "" {
+		return nil, fmt.Errorf("invalid proxy %q, expected [user:password@]host[:port]", proxy)
+	}
+
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "1080")
+	}
+	var username, password string
+	if u.User != nil {
+		username = u.User.Username()
+		password, _ = u.User.Password()
+	}
+
+	fmt.Printf("connecting through SOCKS5 proxy %s\n", address)
+	return []conn.Option{conn.WithDialer(conn.SOCKS5Dialer(address, username, password))}, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+
+	"github.com/rychipman/kerb-debug/capture"
+)
+
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	listen := fs.String("listen", "localhost:27017", "address to serve the capture on")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: kerb-debug replay [-listen addr] <capture file>")
+	}
+
+	events, err := capture.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	s := capture.NewReplayServer(events)
+	s.Logf = func(format string, args ...interface{}) {
+		fmt.Printf(format+"\n", args...)
+	}
+
+	fmt.Printf("replaying %d messages from %s on %s\n", len(events), fs.Arg(0), l.Addr())
+	return s.Serve(l)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/10gen/mongo-go-driver/mongo/connstring"
+	"github.com/10gen/mongo-go-driver/mongo/private/auth"
+	"github.com/10gen/mongo-go-driver/mongo/private/conn"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	sshBastionUsage    = "SSH bastion to reach the servers through, as [user@]host[:port], not along with -proxy or a proxyHost in the uri; the servers' own names are still used for kerberos"
+	sshKeyUsage        = "private key file to log in to the SSH bastion with, in addition to the keys of the SSH agent"
+	sshKnownHostsUsage = "known_hosts file to verify the SSH bastion's host key against (default ~/.ssh/known_hosts)"
+)
+
+// checkSSHBastion rejects the proxies the -ssh-bastion flag cannot be
+// combined with, rather than reaching the bastion without them.
+func checkSSHBastion(bastion, proxy string, cs connstring.ConnString) error {
+	if bastion == "" {
+		return nil
+	}
+	if proxy != "" {
+		return fmt.Errorf("-proxy and -ssh-bastion cannot be used together")
+	}
+	if cs.ProxyHost != "" {
+		return fmt.Errorf("-ssh-bastion cannot be used with the proxyHost of the uri")
+	}
+	return nil
+}
+
+// sshOptions creates the connection options for dialing through the SSH
+// bastion of the -ssh-bastion flag. Every connection shares one SSH
+// connection, which the returned function closes.
+func sshOptions(bastion, keyFile, knownHostsFile string) ([]conn.Option, func(), error) {
+	if bastion == "" {
+		return nil, func() {}, nil
+	}
+
+	u, err := url.Parse("ssh://" + bastion)
+	if err != nil || u.Host == "" || u.Path != "" {
+		return nil, nil, fmt.Errorf("invalid SSH bastion %q, expected [user@]host[:port]", bastion)
+	}
+
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "22")
+	}
+
+	current, err := user.Current()
+	if err != nil {
+		return nil, nil, err
+	}
+	username := current.Username
+	if u.User != nil {
+		username = u.User.Username()
+	}
+
+	methods, closeAgent, err := sshAuthMethods(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if knownHostsFile == "" {
+		knownHostsFile = filepath.Join(current.HomeDir, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		closeAgent()
+		return nil, nil, fmt.Errorf("unable to read known hosts: %v", err)
+	}
+
+	tunnel := conn.NewSSHTunnel(address, &ssh.ClientConfig{
+		User:            username,
+		Auth:            methods,
+		HostKeyCallback: hostKeyCallback,
+	})
+
+	fmt.Printf("connecting through SSH bastion %s as %s\n", address, username)
+	closeTunnel := func() {
+		_ = tunnel.Close()
+		closeAgent()
+	}
+	return []conn.Option{conn.WithDialer(tunnel.Dialer())}, closeTunnel, nil
+}
+
+// sshAuthMethods gets the ways to log in to the bastion: the key file,
+// if there is one, then the keys of the SSH agent, if it is running.
+func sshAuthMethods(keyFile string) ([]ssh.AuthMethod, func(), error) {
+	var methods []ssh.AuthMethod
+	closeAgent := func() {}
+
+	if keyFile != "" {
+		signer, err := readSSHKey(keyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		agentConn, err := net.Dial("unix", socket)
+		if err != nil {
+			fmt.Printf("warning: unable to reach the SSH agent: %v\n", err)
+		} else {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+			closeAgent = func() { _ = agentConn.Close() }
+		}
+	}
+
+	if len(methods) == 0 {
+		return nil, nil, fmt.Errorf("no way to log in to the SSH bastion: start an SSH agent or pass -ssh-key")
+	}
+	return methods, closeAgent, nil
+}
+
+// readSSHKey reads a private key file, asking for its passphrase when it
+// is encrypted.
+func readSSHKey(keyFile string) (ssh.Signer, error) {
+	pem, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(pem)
+	if err != nil && strings.Contains(err.Error(), "encrypted") {
+		var passphrase string
+		passphrase, err = auth.PromptProvider(fmt.Sprintf("passphrase for %s: ", keyFile)).Password(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read SSH key %s: %v", keyFile, err)
+	}
+	return signer, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/10gen/mongo-go-driver/mongo/connstring"
+)
+
+func TestCheckSSHBastion(t *testing.T) {
+	tests := []struct {
+		bastion string
+		proxy   string
+		uri     string
+		err     string
+	}{
+		{uri: "mongodb://db.example.com"},
+		{uri: "mongodb://db.example.com/?proxyHost=socks.example.com", proxy: "other.example.com"},
+		{uri: "mongodb://db.example.com", bastion: "bastion.example.com"},
+		{uri: "mongodb://db.example.com", bastion: "bastion.example.com", proxy: "socks.example.com", err: "-proxy and -ssh-bastion cannot be used together"},
+		{uri: "mongodb://db.example.com/?proxyHost=socks.example.com&proxyPort=1080", bastion: "bastion.example.com", err: "-ssh-bastion cannot be used with the proxyHost of the uri"},
+	}
+
+	for _, test := range tests {
+		cs, err := connstring.Parse(test.uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = checkSSHBastion(test.bastion, test.proxy, cs)
+		if test.err == "" && err != nil {
+			t.Errorf("%s with -ssh-bastion %q and -proxy %q: unexpected error %v", test.uri, test.bastion, test.proxy, err)
+		}
+		if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("%s with -ssh-bastion %q and -proxy %q: expected error %q, but got %v", test.uri, test.bastion, test.proxy, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/10gen/mongo-go-driver/mongo/connstring"
+	"github.com/10gen/mongo-go-driver/mongo/model"
+	"github.com/10gen/mongo-go-driver/mongo/private/cluster"
+)
+
+func runWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	uri := fs.String("uri", "mongodb://ldaptest.10gen.cc:27017", "mongodb uri of the cluster to watch")
+	snapshots := fs.Bool("json", false, "also print a JSON snapshot of the cluster after each change")
+	_ = fs.Parse(args)
+
+	cs, err := connstring.Parse(*uri)
+	if err != nil {
+		return err
+	}
+
+	monitor, err := cluster.StartMonitor(cluster.WithConnString(cs))
+	if err != nil {
+		return err
+	}
+	defer monitor.Stop()
+
+	updates, unsubscribe, err := monitor.Subscribe()
+	if err != nil {
+		return err
+	}
+	defer unsubscribe()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	enc := json.NewEncoder(os.Stdout)
+	current := &model.Cluster{}
+	for {
+		select {
+		case <-interrupt:
+			return nil
+		case desc, ok := <-updates:
+			if !ok {
+				return nil
+			}
+
+			now := time.Now()
+			for _, line := range describeDiff(model.DiffCluster(current, desc)) {
+				fmt.Printf("%s %s\n", now.Format("15:04:05.000"), line)
+			}
+			current = desc
+
+			if *snapshots {
+				if err = enc.Encode(newClusterSnapshot(now, desc)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// describeDiff renders a cluster diff as human readable lines.
+func describeDiff(diff *model.ClusterDiff) []string {
+	var lines []string
+	if diff.OldKind != diff.NewKind {
+		lines = append(lines, fmt.Sprintf("cluster: %s -> %s", diff.OldKind, diff.NewKind))
+	}
+
+	for _, s := range diff.AddedServers {
+		lines = append(lines, fmt.Sprintf("+ %s (%s)", s.Addr, s.Kind))
+	}
+	for _, s := range diff.RemovedServers {
+		lines = append(lines, fmt.Sprintf("- %s (%s)", s.Addr, s.Kind))
+	}
+
+	for _, d := range diff.ChangedServers {
+		before, after := d.Old, d.New
+		if d.Elected() {
+			lines = append(lines, fmt.Sprintf("%s: elected primary (electionId %s)", after.Addr, after.ElectionID.Hex()))
+		}
+		if before.Kind != after.Kind {
+			lines = append(lines, fmt.Sprintf("%s: %s -> %s", after.Addr, before.Kind, after.Kind))
+		}
+		if before.SetName != after.SetName {
+			lines = append(lines, fmt.Sprintf("%s: setName %q -> %q", after.Addr, before.SetName, after.SetName))
+		}
+		if before.SetVersion != after.SetVersion {
+			lines = append(lines, fmt.Sprintf("%s: setVersion %d -> %d", after.Addr, before.SetVersion, after.SetVersion))
+		}
+		if before.ElectionID != after.ElectionID && !d.Elected() {
+			lines = append(lines, fmt.Sprintf("%s: electionId %s -> %s", after.Addr, before.ElectionID.Hex(), after.ElectionID.Hex()))
+		}
+		switch {
+		case after.LastError != nil && (before.LastError == nil || before.LastError.Error() != after.LastError.Error()):
+			lines = append(lines, fmt.Sprintf("%s: error: %v", after.Addr, after.LastError))
+		case after.LastError == nil && before.LastError != nil:
+			lines = append(lines, fmt.Sprintf("%s: recovered", after.Addr))
+		}
+	}
+
+	return lines
+}
+
+type clusterSnapshot struct {
+	Time    time.Time        `json:"time"`
+	Kind    string           `json:"kind"`
+	Servers []serverSnapshot `json:"servers"`
+}
+
+type serverSnapshot struct {
+	Addr       string `json:"addr"`
+	Kind       string `json:"kind"`
+	RTT        string `json:"rtt,omitempty"`
+	SetName    string `json:"setName,omitempty"`
+	SetVersion uint32 `json:"setVersion,omitempty"`
+	ElectionID string `json:"electionId,omitempty"`
+	LastError  string `json:"lastError,omitempty"`
+}
+
+func newClusterSnapshot(t time.Time, desc *model.Cluster) clusterSnapshot {
+	snapshot := clusterSnapshot{
+		Time: t.UTC(),
+		Kind: desc.Kind.String(),
+	}
+
+	for _, s := range desc.Servers {
+		ss := serverSnapshot{
+			Addr:       s.Addr.String(),
+			Kind:       s.Kind.String(),
+			SetName:    s.SetName,
+			SetVersion: s.SetVersion,
+		}
+		if s.AverageRTTSet {
+			ss.RTT = s.AverageRTT.String()
+		}
+		if s.ElectionID != "" {
+			ss.ElectionID = s.ElectionID.Hex()
+		}
+		if s.LastError != nil {
+			ss.LastError = s.LastError.Error()
+		}
+		snapshot.Servers = append(snapshot.Servers, ss)
+	}
+
+	return snapshot
+}